@@ -2,45 +2,104 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/oklog/run"
-	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/saswatamcode/promql-mcp/pkg/audit"
+	"github.com/saswatamcode/promql-mcp/pkg/auth"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+	"github.com/saswatamcode/promql-mcp/pkg/cache"
+	"github.com/saswatamcode/promql-mcp/pkg/certs"
+	"github.com/saswatamcode/promql-mcp/pkg/completion"
+	"github.com/saswatamcode/promql-mcp/pkg/config"
+	"github.com/saswatamcode/promql-mcp/pkg/metrics"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
 	"github.com/saswatamcode/promql-mcp/pkg/prompts"
+	"github.com/saswatamcode/promql-mcp/pkg/resources"
+	"github.com/saswatamcode/promql-mcp/pkg/search"
+	"github.com/saswatamcode/promql-mcp/pkg/templates"
 	"github.com/saswatamcode/promql-mcp/pkg/tools"
+	"github.com/saswatamcode/promql-mcp/pkg/tracing"
+	"github.com/saswatamcode/promql-mcp/pkg/transport"
 )
 
 const (
 	serverInstructions = `Welcome to the PromQL MCP server!
 
-You can use this server to interact with a Prometheus-compatible API or TSDB, but only for the purposes of generating queries.
-This server does not support querying metrics or series directly, but rather focuses on helping you construct valid PromQL queries.
+You can use this server to interact with a Prometheus-compatible API or TSDB, mainly for the purposes of generating queries.
+This server focuses on helping you construct valid PromQL queries, but can also run them within strict cost limits, and look at alerts,
+rules and targets to investigate incidents.
 
 You can use the tool prometheus_get_series to query the series available in the Prometheus instance. This will help you understand the actual available metrics and their labels
 and allow you to construct valid PromQL queries based on that information.
+Set its output argument to summary to get every metric's label names and most common label values instead of every series.
+You can use the tools prometheus_get_metric_names and prometheus_get_label_values to list the names of metrics and the values of a label.
+You can use the tool prometheus_search_metrics to find the metrics measuring something, e.g. disk latency, by their names and help texts,
+rather than guessing regular expressions against __name__.
+
+You can use the tool promql_verify_selectors to check that every selector in a query you have generated actually matches series, and to get
+the closest existing metric names and label values for those that don't.
+You can use the tool promql_list_templates to list a curated library of vetted query templates, e.g. for histogram quantiles, error ratios
+and saturation, and promql_render_template to fill one in with parameters. Prefer these templates over writing queries from scratch.
+You can use the tool promql_estimate_cost to check how many series and samples a query would touch before it is run.
+You can use the tools prometheus_query and prometheus_query_range to run a query, prometheus_get_alerts to get the active alerts,
+prometheus_get_rules to get the alerting and recording rules along with their expressions, and prometheus_get_targets to check the health
+of scrape targets.
+You can use the tool prometheus_capabilities to find out which flavour of backend a datasource is, and which PromQL features, e.g. native
+histogram functions, experimental functions or MetricsQL extensions, it supports.
 
 The user can ask a variety of questions related to health, kube pods, questions around specific workloads and so on. Try to use tools/prompts from this server
-to generate accurate PromQL queries.`
+to generate accurate PromQL queries.
+
+The metric catalog of every datasource is also available as resources, prometheus://<datasource>/metrics lists all metric names with their
+type and help text, prometheus://<datasource>/metric/{name} describes a single metric and prometheus://<datasource>/label/{name}/values lists
+the values of a label. prometheus://<datasource>/alerts lists the alerts currently firing, subscribe to it to be notified as soon as alerts
+start or stop firing.
+
+Every tool takes an optional datasource argument selecting which of the configured Prometheus-compatible datasources to use, and an optional
+tenant argument for multi-tenant datasources. Requests are subject to per-datasource limits on time range, step and number of series, and
+selectors matching every series are rejected. If a tool call is rejected, follow the explanation in the error to narrow it down.
+Tool responses are bounded by a token budget, which every tool call can lower with its max_tokens and max_bytes arguments. Responses
+that exceed it are summarised or truncated, and say what was dropped. Large results of the series, metric names, label values and targets
+tools are split into pages instead, pass the cursor at the end of a page back to the same tool to get the next one.`
 	serverVersion = "0.1.0"
 	serverName    = "promql-mcp"
+
+	// shutdownTimeout is how long in-flight HTTP requests are given to
+	// complete on shutdown.
+	shutdownTimeout = 10 * time.Second
 )
 
 var (
-	apiURL       string
-	mcpServerURL string
-	logLevel     string
-	stdio        bool
+	apiURL         string
+	mcpServerURL   string
+	transports     string
+	metricsAddress string
+	logLevel       string
+	configFile     string
+	stdio          bool
 )
 
 func init() {
-	flag.StringVar(&apiURL, "api-url", "http://localhost:9090", "The Prometheus-compatible API URL")
-	flag.StringVar(&mcpServerURL, "mcp-server-url", ":8080", "The MCP server URL")
+	flag.StringVar(&apiURL, "api-url", "http://localhost:9090", "The Prometheus-compatible API URL, used as the only datasource if no config file is given")
+	flag.StringVar(&configFile, "config-file", "", "Path to a YAML config file with the datasources to use and their limits")
+	flag.StringVar(&mcpServerURL, "mcp-server-url", ":8080", "The address HTTP transports listen on, unless given with the transport")
+	flag.StringVar(&transports, "transport", transport.StreamableHTTP, "Comma-separated transports to serve, any of stdio, streamable-http and sse, each optionally followed by the address it listens on, e.g. streamable-http=:8080,sse=:8081. Overrides the transports of the config file")
+	flag.StringVar(&metricsAddress, "metrics-address", "", "The address to serve the metrics of the server on, e.g. :9091. By default they are served on "+metrics.Path+" of every HTTP transport address")
 	flag.StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
-	flag.BoolVar(&stdio, "stdio", false, "Use stdio transport")
+	flag.BoolVar(&stdio, "stdio", false, "Use stdio transport. Deprecated: use -transport=stdio")
 	flag.Parse()
 
 	logHandler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
@@ -50,29 +109,169 @@ func init() {
 }
 
 func main() {
-	slog.Info("Prometheus-compatible API URL configured", "url", apiURL)
 	slog.Info("Log level set to", "level", logLevel)
 
-	client, err := api.NewClient(api.Config{
-		Address: apiURL,
-	})
+	// Experimental aggregations, e.g. limitk, are parsed so that they can be
+	// checked against what the backend supports, rather than being rejected
+	// outright. Unlike experimental functions, the parser has no option for
+	// them.
+	parser.EnableExperimentalFunctions = true
+
+	cfg := config.Default(apiURL)
+	if configFile != "" {
+		var err error
+		cfg, err = config.Load(configFile)
+		if err != nil {
+			slog.Error("Error loading config file", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	transportCfgs, err := transportConfigs(cfg)
+	if err != nil {
+		slog.Error("Error configuring transports", "error", err)
+		os.Exit(1)
+	}
+	// Stdout carries the messages of the stdio transport.
+	servesStdio := slices.ContainsFunc(transportCfgs, func(t transport.Config) bool { return t.Type == transport.Stdio })
+	if cfg.Tracing.Exporter == tracing.ExporterStdout && servesStdio {
+		slog.Error("Error configuring tracing", "error", "the stdout exporter can't be used along with the stdio transport, use the file exporter instead")
+		os.Exit(1)
+	}
+	if cfg.Audit.Output == audit.OutputStdout && servesStdio {
+		slog.Error("Error configuring the audit log", "error", "the audit log can't be written to stdout along with the stdio transport, write it to a file instead")
+		os.Exit(1)
+	}
+
+	tracer, err := tracing.New(context.Background(), cfg.Tracing, serverName, serverVersion)
+	if err != nil {
+		slog.Error("Error configuring tracing", "error", err)
+		os.Exit(1)
+	}
+	auditLog, err := audit.New(cfg.Audit)
+	if err != nil {
+		slog.Error("Error configuring the audit log", "error", err)
+		os.Exit(1)
+	}
+	serverMetrics := metrics.New()
+	backends, err := backend.NewSet(cfg.Datasources, cache.New(cfg.Cache), serverMetrics, tracer, auditLog)
+	if err != nil {
+		slog.Error("Error creating Prometheus clients", "error", err)
+		os.Exit(1)
+	}
+	for _, ds := range cfg.Datasources {
+		slog.Info("Prometheus-compatible datasource configured", "name", ds.Name, "url", ds.URL)
+	}
+
+	library, err := templates.Load(cfg.QueryTemplatesDir)
+	if err != nil {
+		slog.Error("Error loading query templates", "error", err)
+		os.Exit(1)
+	}
+
+	serverPrompts, err := prompts.Load(cfg.PromptsDir, cfg.PromptVariables, backends)
+	if err != nil {
+		slog.Error("Error loading prompt templates", "error", err)
+		os.Exit(1)
+	}
+
+	semantic, err := search.NewSemantic(cfg.Search)
+	if err != nil {
+		slog.Error("Error configuring metric search", "error", err)
+		os.Exit(1)
+	}
+
+	var reloader *certs.Reloader
+	var mtlsRoots func() *x509.CertPool
+	if cfg.TLS.Enabled() {
+		var authClientCAFile string
+		if cfg.Auth.MTLS != nil {
+			authClientCAFile = cfg.Auth.MTLS.ClientCAFile
+		}
+		reloader, err = certs.NewReloader(cfg.TLS, authClientCAFile)
+		if err != nil {
+			slog.Error("Error loading TLS certificates", "error", err)
+			os.Exit(1)
+		}
+		mtlsRoots = reloader.AuthClientCAs
+	}
+	var authenticator *auth.Authenticator
+	if cfg.Auth.Enabled() {
+		authenticator, err = auth.NewAuthenticator(cfg.Auth, mtlsRoots)
+		if err != nil {
+			slog.Error("Error configuring authentication", "error", err)
+			os.Exit(1)
+		}
+	}
+	authorizer, err := auth.NewAuthorizer(cfg.Auth.Policies, backends)
 	if err != nil {
-		slog.Error("Error creating Prometheus client", "error", err)
+		slog.Error("Error configuring authorization", "error", err)
 		os.Exit(1)
 	}
 
+	completer := completion.NewProvider(backends)
+	subscriptions := resources.NewSubscriptions()
+	hooks := &server.Hooks{}
+	subscriptions.Register(hooks)
+	serverMetrics.Register(hooks)
+	tracer.Register(hooks)
+	authorizer.Register(hooks)
+
 	mcpServer := server.NewMCPServer(
 		serverName,
 		serverVersion,
 		server.WithToolCapabilities(true),
 		server.WithPromptCapabilities(true),
+		server.WithResourceCapabilities(true, true),
+		server.WithCompletions(),
+		server.WithPromptCompletionProvider(authorizer.PromptCompletionProvider(completer)),
+		server.WithResourceCompletionProvider(authorizer.ResourceCompletionProvider(completer)),
 		server.WithLogging(),
 		server.WithInstructions(serverInstructions),
+		server.WithHooks(hooks),
+		// Middlewares run in the order they are added, the first outermost.
+		// Those of metrics wrap the budget middleware, to measure responses
+		// as they are sent.
+		server.WithToolHandlerMiddleware(tracer.ToolMiddleware()),
+		server.WithPromptHandlerMiddleware(tracer.PromptMiddleware()),
+		server.WithResourceHandlerMiddleware(tracer.ResourceMiddleware()),
+		server.WithToolHandlerMiddleware(auditLog.ToolMiddleware(backends)),
+		server.WithPromptHandlerMiddleware(auditLog.PromptMiddleware(backends)),
+		server.WithResourceHandlerMiddleware(auditLog.ResourceMiddleware()),
+		server.WithToolHandlerMiddleware(serverMetrics.ToolMiddleware()),
+		server.WithPromptHandlerMiddleware(serverMetrics.PromptMiddleware()),
+		server.WithToolFilter(authorizer.ToolFilter()),
+		server.WithPromptFilter(authorizer.PromptFilter()),
+		server.WithToolHandlerMiddleware(authorizer.ToolMiddleware()),
+		server.WithPromptHandlerMiddleware(authorizer.PromptMiddleware()),
+		server.WithResourceHandlerMiddleware(authorizer.ResourceMiddleware()),
+		server.WithToolHandlerMiddleware(budget.Middleware(cfg.Budget)),
 	)
 
-	mcpServer.AddTool(tools.GetSeries(client))
-	mcpServer.AddPrompt(prompts.GeneratePromQL(client))
-	mcpServer.AddPrompt(prompts.GeneratePersesDashboard())
+	pages := pagination.NewStore(cfg.Pagination)
+	mcpServer.AddTool(tools.GetSeries(backends, pages))
+	mcpServer.AddTool(tools.GetMetricNames(backends, pages))
+	mcpServer.AddTool(tools.GetLabelValues(backends, pages))
+	mcpServer.AddTool(tools.SearchMetrics(backends, semantic))
+	mcpServer.AddTool(tools.VerifySelectors(backends))
+	mcpServer.AddTool(tools.EstimateCost(backends))
+	mcpServer.AddTool(tools.ListTemplates(library))
+	mcpServer.AddTool(tools.RenderTemplate(backends, library))
+	mcpServer.AddTool(tools.Query(backends))
+	mcpServer.AddTool(tools.QueryRange(backends))
+	mcpServer.AddTool(tools.GetAlerts(backends))
+	mcpServer.AddTool(tools.GetRules(backends))
+	mcpServer.AddTool(tools.GetTargets(backends, pages))
+	mcpServer.AddTool(tools.Capabilities(backends))
+	for _, p := range serverPrompts {
+		mcpServer.AddPrompt(p.Prompt, p.Handler)
+	}
+	for _, b := range backends.All() {
+		mcpServer.AddResource(resources.MetricCatalog(b))
+		mcpServer.AddResource(resources.Alerts(b))
+		mcpServer.AddResourceTemplate(resources.Metric(b))
+		mcpServer.AddResourceTemplate(resources.LabelValues(b))
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -80,33 +279,144 @@ func main() {
 	{
 		g.Add(run.SignalHandler(ctx, os.Interrupt, syscall.SIGINT, syscall.SIGTERM))
 	}
-	{
-		if stdio {
-			slog.Info("Starting PromQL MCP server using stdio transport")
-			stdioServer := server.NewStdioServer(mcpServer)
-			g.Add(func() error {
-				return stdioServer.Listen(ctx, os.Stdin, os.Stdout)
-			}, func(_ error) {
-				cancel()
-			})
-		} else {
-			slog.Info("Starting PromQL MCP server using Streamable HTTP transport on " + mcpServerURL)
-			httpServer := server.NewStreamableHTTPServer(mcpServer)
+	for _, b := range backends.All() {
+		g.Add(func() error {
+			return b.RunEnvironmentDiscovery(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	for _, b := range backends.All() {
+		if b.AlertPollInterval <= 0 {
+			continue
+		}
+		watcher := resources.NewAlertWatcher(b, b.AlertPollInterval, mcpServer, subscriptions)
+		g.Add(func() error {
+			return watcher.Run(ctx)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	for _, t := range transportCfgs {
+		if t.Type != transport.Stdio {
+			continue
+		}
+		slog.Info("Starting PromQL MCP server using stdio transport")
+		stdioServer := server.NewStdioServer(mcpServer)
+		g.Add(func() error {
+			return stdioServer.Listen(ctx, os.Stdin, os.Stdout)
+		}, func(_ error) {
+			cancel()
+		})
+	}
+	var wrap func(http.Handler) http.Handler
+	if authenticator != nil {
+		wrap = authenticator.Handler
+	}
+	var tlsConfig *tls.Config
+	if reloader != nil {
+		tlsConfig = reloader.TLSConfig()
+	}
+	listeners := transport.Listeners(mcpServer, transportCfgs, func(h http.Handler) http.Handler {
+		if wrap != nil {
+			h = wrap(h)
+		}
+		return tracer.Handler(h)
+	}, tlsConfig)
+	if len(listeners) > 0 {
+		if authenticator == nil {
+			slog.Warn("The MCP HTTP endpoints are not authenticated, anyone who can reach them can query the datasources with the credentials of the server")
+		}
+		if reloader != nil {
 			g.Add(func() error {
-				return httpServer.Start(mcpServerURL)
+				return reloader.Run(ctx)
 			}, func(_ error) {
-				_ = httpServer.Shutdown(ctx)
 				cancel()
 			})
 		}
 	}
+	if metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle(metrics.Path, serverMetrics.Handler())
+		metricsServer := &http.Server{Addr: metricsAddress, Handler: mux}
+		slog.Info("Serving metrics on " + metricsAddress + metrics.Path)
+		g.Add(func() error {
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}, func(_ error) {
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancelShutdown()
+			_ = metricsServer.Shutdown(shutdownCtx)
+			cancel()
+		})
+	} else if len(listeners) == 0 {
+		slog.Warn("Metrics are not served without HTTP transports, set -metrics-address to serve them")
+	}
+	for _, l := range listeners {
+		if metricsAddress == "" {
+			handler := serverMetrics.Handler()
+			if wrap != nil {
+				handler = wrap(handler)
+			}
+			if err := l.Handle(metrics.Path, handler); err != nil {
+				slog.Error("Error serving metrics", "error", err)
+				os.Exit(1)
+			}
+		}
+		slog.Info("Starting PromQL MCP server using HTTP transports on "+l.Address, "transports", l.Transports, "tls", tlsConfig != nil)
+		g.Add(l.Run, func(_ error) {
+			// Give in-flight requests some time to complete, as ctx may
+			// already be canceled.
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancelShutdown()
+			if err := l.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("Error shutting down HTTP server", "address", l.Address, "error", err)
+			}
+			cancel()
+		})
+	}
 
-	if err := g.Run(); err != nil {
+	err = g.Run()
+	// Export the spans of the last requests.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Error shutting down tracing", "error", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		slog.Warn("Error closing the audit log", "error", err)
+	}
+	if err != nil {
+		var signalErr run.SignalError
+		if errors.As(err, &signalErr) {
+			slog.Info("Shutting down", "signal", signalErr.Signal)
+			return
+		}
 		slog.Error("Error starting run group", "error", err)
 		os.Exit(1)
 	}
 }
 
+// transportConfigs returns the transports to serve, from the -transport flag if
+// set, or else from the config file, or else Streamable HTTP on -mcp-server-url.
+func transportConfigs(cfg *config.Config) ([]transport.Config, error) {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "transport"
+	})
+	switch {
+	case stdio && !explicit:
+		slog.Warn("The -stdio flag is deprecated, use -transport=stdio instead")
+		return transport.Parse(transport.Stdio, mcpServerURL)
+	case !explicit && len(cfg.Transports) > 0:
+		return cfg.Transports, transport.Validate(cfg.Transports)
+	default:
+		return transport.Parse(transports, mcpServerURL)
+	}
+}
+
 func getLogLevel(level string) slog.Level {
 	switch level {
 	case "debug":
@@ -0,0 +1,360 @@
+// Package audit records every tool call, prompt request and resource read as a
+// JSON line: who made it, with which arguments, against which datasource and
+// tenant, and how it went.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/auth"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	OutputNone   = ""
+	OutputStdout = "stdout"
+
+	// redacted replaces the values of redacted arguments.
+	redacted = "<redacted>"
+)
+
+// DefaultConfig is the audit configuration used if none is configured, with
+// the audit log disabled.
+var DefaultConfig = Config{MaxSizeMB: 100, MaxBackups: 10}
+
+// Config configures the audit log.
+type Config struct {
+	// Output is stdout, or the path of the file records are appended to, or
+	// empty to disable the audit log.
+	Output string `yaml:"output"`
+	// MaxSizeMB is the size in megabytes at which the file is rotated.
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// MaxBackups is how many rotated files are kept, zero keeps them all.
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAge is how long rotated files are kept, rounded up to days, zero
+	// keeps them regardless of their age.
+	MaxAge model.Duration `yaml:"max_age"`
+	// Compress gzips rotated files.
+	Compress bool `yaml:"compress"`
+	// RedactedArguments are glob patterns of the names of the arguments whose
+	// values are redacted, e.g. query, or * for every argument.
+	RedactedArguments []string `yaml:"redacted_arguments"`
+}
+
+// Record is a single entry of the audit log.
+type Record struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+	// Identity is the authenticated caller, empty if the transport isn't
+	// authenticated.
+	Identity   string `json:"identity,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	// Kind is tool, prompt or resource.
+	Kind       string         `json:"kind"`
+	Name       string         `json:"name"`
+	Arguments  map[string]any `json:"arguments,omitempty"`
+	Datasource string         `json:"datasource,omitempty"`
+	Tenant     string         `json:"tenant,omitempty"`
+	// DurationSeconds is how long the request took to handle.
+	DurationSeconds float64 `json:"duration_seconds"`
+	// UpstreamRequests is the number of requests made against the
+	// datasource, and UpstreamSeconds the time they took together.
+	UpstreamRequests int     `json:"upstream_requests"`
+	UpstreamSeconds  float64 `json:"upstream_seconds"`
+	// ResultBytes is the size of the text of the result.
+	ResultBytes int `json:"result_bytes"`
+	// Error is the error the call failed with, redacted if any argument is,
+	// as errors often quote arguments, e.g. the selectors of a query.
+	Error string `json:"error,omitempty"`
+
+	// redactsArguments is set if any argument is redacted.
+	redactsArguments bool
+}
+
+// setError records msg as the error of the call.
+func (rec *Record) setError(msg string) {
+	if rec.redactsArguments {
+		msg = redacted
+	}
+	rec.Error = msg
+}
+
+// Logger writes the audit log. It implements backend.Observer to measure the
+// requests made against backends on behalf of every call. A nil Logger is
+// valid and logs nothing.
+type Logger struct {
+	redacted []string
+
+	mtx sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// New returns the audit logger configured by cfg, or nil if the audit log is
+// disabled.
+func New(cfg Config) (*Logger, error) {
+	for _, p := range cfg.RedactedArguments {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid redacted argument pattern %q: %w", p, err)
+		}
+	}
+
+	var w io.WriteCloser
+	switch cfg.Output {
+	case OutputNone:
+		return nil, nil
+	case OutputStdout:
+		w = nopCloser{os.Stdout}
+	default:
+		// Fail early rather than on the first record if the file can't be
+		// written.
+		f, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+		f.Close()
+		w = &lumberjack.Logger{
+			Filename:   cfg.Output,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     int(math.Ceil(time.Duration(cfg.MaxAge).Hours() / 24)),
+			Compress:   cfg.Compress,
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Logger{redacted: cfg.RedactedArguments, w: w, enc: enc}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// Close closes the audit log.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.w.Close()
+}
+
+// ToolMiddleware returns a tool handler middleware logging every tool call,
+// along with the datasource and tenant it was made against, resolved with
+// backends.
+func (l *Logger) ToolMiddleware(backends *backend.Set) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			datasource, _ := args["datasource"].(string)
+			tenant, _ := args["tenant"].(string)
+			datasource, tenant = target(ctx, backends, datasource, tenant)
+
+			ctx, rec := l.start(ctx, "tool", request.Params.Name, args)
+			res, err := next(ctx, request)
+			if res != nil {
+				for _, c := range res.Content {
+					if t, ok := c.(mcp.TextContent); ok {
+						rec.ResultBytes += len(t.Text)
+						if res.IsError && rec.Error == "" {
+							rec.setError(t.Text)
+						}
+					}
+				}
+			}
+			l.finish(ctx, rec, datasource, tenant, err)
+			return res, err
+		}
+	}
+}
+
+// PromptMiddleware returns a prompt handler middleware logging every prompt
+// request. Prompts whose datasource argument isn't the name of a datasource,
+// e.g. a Perses datasource, are logged against the default datasource.
+func (l *Logger) PromptMiddleware(backends *backend.Set) server.PromptHandlerMiddleware {
+	return func(next server.PromptHandlerFunc) server.PromptHandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			args := make(map[string]any, len(request.Params.Arguments))
+			for k, v := range request.Params.Arguments {
+				args[k] = v
+			}
+			datasource, _ := target(ctx, backends, request.Params.Arguments["datasource"], "")
+
+			ctx, rec := l.start(ctx, "prompt", request.Params.Name, args)
+			res, err := next(ctx, request)
+			if res != nil {
+				for _, m := range res.Messages {
+					if t, ok := m.Content.(mcp.TextContent); ok {
+						rec.ResultBytes += len(t.Text)
+					}
+				}
+			}
+			l.finish(ctx, rec, datasource, "", err)
+			return res, err
+		}
+	}
+}
+
+// ResourceMiddleware returns a resource handler middleware logging every
+// resource read.
+func (l *Logger) ResourceMiddleware() server.ResourceHandlerMiddleware {
+	return func(next server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			datasource := ""
+			if u, err := url.Parse(request.Params.URI); err == nil {
+				datasource = u.Host
+			}
+
+			ctx, rec := l.start(ctx, "resource", request.Params.URI, request.Params.Arguments)
+			res, err := next(ctx, request)
+			for _, c := range res {
+				if t, ok := c.(mcp.TextResourceContents); ok {
+					rec.ResultBytes += len(t.Text)
+				}
+			}
+			l.finish(ctx, rec, datasource, "", err)
+			return res, err
+		}
+	}
+}
+
+// upstream accumulates the requests made against backends on behalf of a
+// single call, which may be concurrent.
+type upstream struct {
+	mtx      sync.Mutex
+	requests int
+	duration time.Duration
+}
+
+type upstreamKey struct{}
+
+// start returns the record of a call, and a context accumulating the requests
+// made on its behalf.
+func (l *Logger) start(ctx context.Context, kind, name string, args map[string]any) (context.Context, *Record) {
+	rec := &Record{
+		Time: time.Now(),
+		Kind: kind,
+		Name: name,
+	}
+	rec.Arguments, rec.redactsArguments = l.redact(args)
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		rec.SessionID = session.SessionID()
+	}
+	if id, ok := auth.IdentityFromContext(ctx); ok {
+		rec.Identity = id.Name
+		rec.AuthMethod = id.Method
+	}
+	return context.WithValue(ctx, upstreamKey{}, &upstream{}), rec
+}
+
+// finish completes the record of a call and writes it.
+func (l *Logger) finish(ctx context.Context, rec *Record, datasource, tenant string, err error) {
+	rec.DurationSeconds = time.Since(rec.Time).Seconds()
+	rec.Datasource = datasource
+	rec.Tenant = tenant
+	if u, ok := ctx.Value(upstreamKey{}).(*upstream); ok {
+		u.mtx.Lock()
+		rec.UpstreamRequests = u.requests
+		rec.UpstreamSeconds = u.duration.Seconds()
+		u.mtx.Unlock()
+	}
+	if err != nil {
+		rec.setError(err.Error())
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if err := l.enc.Encode(rec); err != nil {
+		slog.Error("error writing audit record", "error", err)
+	}
+}
+
+// redact returns a copy of args with the values of redacted arguments
+// replaced, and whether any were.
+func (l *Logger) redact(args map[string]any) (map[string]any, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	out := make(map[string]any, len(args))
+	hidden := false
+	for k, v := range args {
+		out[k] = v
+		for _, p := range l.redacted {
+			if ok, _ := path.Match(p, k); ok {
+				out[k] = redacted
+				hidden = true
+				break
+			}
+		}
+	}
+	return out, hidden
+}
+
+// target resolves the datasource and tenant requests are sent to when they
+// aren't set.
+func target(ctx context.Context, backends *backend.Set, datasource, tenant string) (string, string) {
+	b, err := backends.Get(datasource)
+	if err != nil {
+		return datasource, tenant
+	}
+	if !b.Multitenant() {
+		return b.Name, ""
+	}
+	if tenant == "" {
+		tenant = b.Tenant(ctx)
+	}
+	return b.Name, tenant
+}
+
+// RoundTripper implements backend.Observer, accumulating the requests made
+// against backends into the call they are made on behalf of.
+func (l *Logger) RoundTripper(_ string, next http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return next
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		if u, ok := req.Context().Value(upstreamKey{}).(*upstream); ok {
+			u.mtx.Lock()
+			u.requests++
+			u.duration += time.Since(start)
+			u.mtx.Unlock()
+		}
+		return resp, err
+	})
+}
+
+// ObserveCache implements backend.Observer.
+func (l *Logger) ObserveCache(context.Context, string, string, bool) {}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/saswatamcode/promql-mcp/pkg/auth"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+// testLogger returns a logger writing to buf.
+func testLogger(buf *bytes.Buffer, redactedArguments ...string) *Logger {
+	return &Logger{redacted: redactedArguments, w: nopCloser{buf}, enc: json.NewEncoder(buf)}
+}
+
+func testBackends(t *testing.T) *backend.Set {
+	t.Helper()
+	backends, err := backend.NewSet([]backend.Config{
+		{Name: "prometheus", URL: "http://localhost:9090"},
+		{Name: "thanos", URL: "http://thanos:9090", TenantHeader: "THANOS-TENANT"},
+		{Name: "mimir", URL: "http://mimir:9090", TenantHeader: "X-Scope-OrgID", Tenant: "team-a"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backends
+}
+
+func TestRedact(t *testing.T) {
+	args := map[string]any{"query": "up", "match": `{job="api"}`, "datasource": "thanos"}
+	for _, tc := range []struct {
+		name         string
+		patterns     []string
+		args         map[string]any
+		want         map[string]any
+		wantRedacted bool
+	}{
+		{name: "no arguments", patterns: []string{"*"}},
+		{name: "no patterns", args: args, want: args},
+		{name: "by name", patterns: []string{"query"}, args: args, want: map[string]any{"query": redacted, "match": `{job="api"}`, "datasource": "thanos"}, wantRedacted: true},
+		{name: "by glob", patterns: []string{"ma*", "q?ery"}, args: args, want: map[string]any{"query": redacted, "match": redacted, "datasource": "thanos"}, wantRedacted: true},
+		{name: "every argument", patterns: []string{"*"}, args: args, want: map[string]any{"query": redacted, "match": redacted, "datasource": redacted}, wantRedacted: true},
+		{name: "no match", patterns: []string{"tenant"}, args: args, want: args},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, hidden := testLogger(&bytes.Buffer{}, tc.patterns...).redact(tc.args)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got arguments %v, expected %v", got, tc.want)
+			}
+			if hidden != tc.wantRedacted {
+				t.Errorf("got redacted %v, expected %v", hidden, tc.wantRedacted)
+			}
+		})
+	}
+	if args["query"] != "up" {
+		t.Error("the arguments of the call were modified")
+	}
+}
+
+func TestTarget(t *testing.T) {
+	backends := testBackends(t)
+	tenantCtx, err := backends.All()[1].WithTenant(context.Background(), "team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name                       string
+		ctx                        context.Context
+		datasource, tenant         string
+		wantDatasource, wantTenant string
+	}{
+		{name: "default datasource", datasource: "", wantDatasource: "prometheus"},
+		{name: "tenant of a single-tenant datasource is dropped", datasource: "prometheus", tenant: "team-a", wantDatasource: "prometheus"},
+		{name: "explicit tenant", datasource: "thanos", tenant: "team-b", wantDatasource: "thanos", wantTenant: "team-b"},
+		{name: "no tenant", datasource: "thanos", wantDatasource: "thanos"},
+		{name: "tenant of the context", ctx: tenantCtx, datasource: "thanos", wantDatasource: "thanos", wantTenant: "team-b"},
+		{name: "default tenant", datasource: "mimir", wantDatasource: "mimir", wantTenant: "team-a"},
+		{name: "unknown datasource", datasource: "other", tenant: "team-c", wantDatasource: "other", wantTenant: "team-c"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			datasource, tenant := target(ctx, backends, tc.datasource, tc.tenant)
+			if datasource != tc.wantDatasource || tenant != tc.wantTenant {
+				t.Errorf("got %s/%s, expected %s/%s", datasource, tenant, tc.wantDatasource, tc.wantTenant)
+			}
+		})
+	}
+}
+
+func TestToolMiddleware(t *testing.T) {
+	backends := testBackends(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name      string
+		redacted  []string
+		result    *mcp.CallToolResult
+		err       error
+		wantError string
+	}{
+		{name: "success", result: mcp.NewToolResultText("up 1")},
+		{name: "tool error", result: mcp.NewToolResultError(`selector {job=~".+"} is rejected`), wantError: `selector {job=~".+"} is rejected`},
+		{name: "redacted tool error", redacted: []string{"query"}, result: mcp.NewToolResultError(`selector {job=~".+"} is rejected`), wantError: redacted},
+		{name: "handler error", result: mcp.NewToolResultError("error querying Prometheus"), err: errors.New(`bad_data: parse error in "up{"`), wantError: `bad_data: parse error in "up{"`},
+		{name: "redacted handler error", redacted: []string{"*"}, err: errors.New(`bad_data: parse error in "up{"`), wantError: redacted},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := testLogger(&buf, tc.redacted...)
+			rt := l.RoundTripper("thanos", http.DefaultTransport)
+			handler := l.ToolMiddleware(backends)(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				for range 2 {
+					req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					resp, err := rt.RoundTrip(req)
+					if err != nil {
+						t.Fatal(err)
+					}
+					resp.Body.Close()
+				}
+				return tc.result, tc.err
+			})
+
+			ctx := auth.WithIdentity(context.Background(), &auth.Identity{Name: "grafana", Method: "bearer"})
+			request := mcp.CallToolRequest{}
+			request.Params.Name = "prometheus_query"
+			request.Params.Arguments = map[string]any{"query": `up{job=~".+"}`, "datasource": "thanos", "tenant": "team-b"}
+			if _, err := handler(ctx, request); !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, expected %v", err, tc.err)
+			}
+
+			var rec Record
+			if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+				t.Fatalf("invalid record %q: %v", buf.String(), err)
+			}
+			if rec.Kind != "tool" || rec.Name != "prometheus_query" || rec.Identity != "grafana" || rec.AuthMethod != "bearer" {
+				t.Errorf("got record of the %s %s by %s with %s, expected the tool prometheus_query by grafana with bearer", rec.Kind, rec.Name, rec.Identity, rec.AuthMethod)
+			}
+			if rec.Datasource != "thanos" || rec.Tenant != "team-b" {
+				t.Errorf("got target %s/%s, expected thanos/team-b", rec.Datasource, rec.Tenant)
+			}
+			if rec.UpstreamRequests != 2 || rec.UpstreamSeconds <= 0 {
+				t.Errorf("got %d upstream requests taking %vs, expected 2", rec.UpstreamRequests, rec.UpstreamSeconds)
+			}
+			if query := rec.Arguments["query"]; (len(tc.redacted) > 0) != (query == redacted) {
+				t.Errorf("got query argument %v with redacted arguments %v", query, tc.redacted)
+			}
+			if tc.result != nil && rec.ResultBytes != len(tc.result.Content[0].(mcp.TextContent).Text) {
+				t.Errorf("got %d result bytes, expected the size of the result", rec.ResultBytes)
+			}
+			if rec.Error != tc.wantError {
+				t.Errorf("got error %q, expected %q", rec.Error, tc.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Package auth authenticates the callers of the HTTP transports of the server,
+// with static bearer tokens, JWTs or mTLS client certificates, and authorizes
+// what they may use according to per-identity policies.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Config configures the authentication methods and the policies of callers.
+// Authentication is disabled if no method is configured.
+type Config struct {
+	BearerTokens []BearerToken `yaml:"bearer_tokens"`
+	JWT          *JWTConfig    `yaml:"jwt"`
+	MTLS         *MTLSConfig   `yaml:"mtls"`
+	// Policies control what every identity may use. Every authenticated
+	// identity may use everything if there are none, and nothing if none of
+	// them applies to it.
+	Policies []Policy `yaml:"policies"`
+}
+
+// BearerToken is a static token identifying a caller.
+type BearerToken struct {
+	Identity string `yaml:"identity"`
+	// Token is the token itself, or TokenFile the file it is read from.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// Enabled returns whether any authentication method is configured.
+func (c Config) Enabled() bool {
+	return len(c.BearerTokens) > 0 || c.JWT != nil || c.MTLS != nil
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name string
+	// Method is the authentication method of the caller, bearer, jwt or mtls.
+	Method string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity of the caller ctx is for, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// errNoCredentials is returned by authenticators for requests without the
+// credentials they check.
+var errNoCredentials = errors.New("no credentials")
+
+type authenticator interface {
+	authenticate(r *http.Request) (*Identity, error)
+}
+
+// Authenticator authenticates HTTP requests.
+type Authenticator struct {
+	authenticators []authenticator
+}
+
+// NewAuthenticator returns an authenticator for the methods configured in cfg.
+// mtlsRoots returns the latest CA certificates of mTLS authentication, which
+// are loaded along with those of TLS, and must be set if it is configured.
+func NewAuthenticator(cfg Config, mtlsRoots func() *x509.CertPool) (*Authenticator, error) {
+	a := &Authenticator{}
+	if len(cfg.BearerTokens) > 0 {
+		tokens := make(staticTokens, 0, len(cfg.BearerTokens))
+		for i, t := range cfg.BearerTokens {
+			if t.Identity == "" {
+				return nil, fmt.Errorf("bearer token %d has no identity", i)
+			}
+			token := t.Token
+			if t.TokenFile != "" {
+				b, err := os.ReadFile(t.TokenFile)
+				if err != nil {
+					return nil, fmt.Errorf("reading bearer token of %s: %w", t.Identity, err)
+				}
+				token = strings.TrimSpace(string(b))
+			}
+			if token == "" {
+				return nil, fmt.Errorf("bearer token of %s is empty", t.Identity)
+			}
+			tokens = append(tokens, BearerToken{Identity: t.Identity, Token: token})
+		}
+		a.authenticators = append(a.authenticators, tokens)
+	}
+	if cfg.JWT != nil {
+		j, err := newJWTAuthenticator(*cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.authenticators = append(a.authenticators, j)
+	}
+	if cfg.MTLS != nil {
+		m, err := newMTLSAuthenticator(*cfg.MTLS, mtlsRoots)
+		if err != nil {
+			return nil, err
+		}
+		a.authenticators = append(a.authenticators, m)
+	}
+	return a, nil
+}
+
+// Authenticate returns the identity of the caller of r, trying every
+// configured method in turn.
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	var errs []error
+	for _, auth := range a.authenticators {
+		id, err := auth.authenticate(r)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, errNoCredentials) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if _, ok := bearerToken(r); ok {
+		return nil, errors.New("invalid bearer token")
+	}
+	return nil, errNoCredentials
+}
+
+// Handler rejects the requests that don't authenticate, and passes the
+// identity of the others on to next in their context.
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			slog.Warn("rejected unauthenticated request", "remote", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="promql-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+type staticTokens []BearerToken
+
+func (s staticTokens) authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, errNoCredentials
+	}
+	for _, t := range s {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return &Identity{Name: t.Identity, Method: "bearer"}, nil
+		}
+	}
+	// The token may still be a JWT.
+	return nil, errNoCredentials
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
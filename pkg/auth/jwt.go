@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig configures the validation of JWTs sent as bearer tokens.
+type JWTConfig struct {
+	// JWKSFile is a JSON Web Key Set with the public keys tokens are signed
+	// with. It is read again whenever it changes, to rotate keys.
+	JWKSFile string `yaml:"jwks_file"`
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// IdentityClaim is the claim holding the identity of the caller, sub by
+	// default.
+	IdentityClaim string `yaml:"identity_claim"`
+}
+
+type jwtAuthenticator struct {
+	cfg    JWTConfig
+	parser *jwt.Parser
+
+	mu      sync.Mutex
+	keys    map[string]any
+	modTime time.Time
+}
+
+func newJWTAuthenticator(cfg JWTConfig) (*jwtAuthenticator, error) {
+	if cfg.JWKSFile == "" {
+		return nil, errors.New("jwt authentication needs a jwks_file")
+	}
+	if cfg.IdentityClaim == "" {
+		cfg.IdentityClaim = "sub"
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	j := &jwtAuthenticator{cfg: cfg, parser: jwt.NewParser(opts...)}
+	if _, err := j.jwks(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *jwtAuthenticator) authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	// Only tokens that look like JWTs are ours to validate.
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, errNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(token, claims, j.key); err != nil {
+		return nil, fmt.Errorf("invalid jwt: %w", err)
+	}
+	name, _ := claims[j.cfg.IdentityClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("invalid jwt: no %s claim", j.cfg.IdentityClaim)
+	}
+	return &Identity{Name: name, Method: "jwt"}, nil
+}
+
+// key returns the key of the JWKS that token is signed with.
+func (j *jwtAuthenticator) key(token *jwt.Token) (any, error) {
+	keys, err := j.jwks()
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k, nil
+		}
+	}
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return k, nil
+}
+
+// jwks returns the keys of the JWKS file by key id, reading it again if it
+// changed.
+func (j *jwtAuthenticator) jwks() (map[string]any, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info, err := os.Stat(j.cfg.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading jwks: %w", err)
+	}
+	if j.keys != nil && info.ModTime().Equal(j.modTime) {
+		return j.keys, nil
+	}
+
+	b, err := os.ReadFile(j.cfg.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading jwks: %w", err)
+	}
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jwks %s: %w", j.cfg.JWKSFile, err)
+	}
+	j.keys, j.modTime = keys, info.ModTime()
+	return keys, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the public signing keys of a JWKS by key id.
+func parseJWKS(b []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
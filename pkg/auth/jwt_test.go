@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTAuthenticate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kid": "k1",
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j, err := newJWTAuthenticator(JWTConfig{JWKSFile: jwksFile, Issuer: "https://sso.example.com", Audience: "promql-mcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(modify func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub": "grafana",
+			"iss": "https://sso.example.com",
+			"aud": "promql-mcp",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, c jwt.MapClaims, k any) string {
+		token := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "valid", token: sign(jwt.SigningMethodES256, "k1", claims(nil), key)},
+		{name: "single key without kid", token: sign(jwt.SigningMethodES256, "", claims(nil), key)},
+		{name: "expired", token: sign(jwt.SigningMethodES256, "k1", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), key), wantErr: "expired"},
+		{name: "without expiry", token: sign(jwt.SigningMethodES256, "k1", claims(func(c jwt.MapClaims) { delete(c, "exp") }), key), wantErr: "exp claim is required"},
+		{name: "other issuer", token: sign(jwt.SigningMethodES256, "k1", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }), key), wantErr: "invalid issuer"},
+		{name: "other audience", token: sign(jwt.SigningMethodES256, "k1", claims(func(c jwt.MapClaims) { c["aud"] = "other" }), key), wantErr: "invalid audience"},
+		{name: "without identity", token: sign(jwt.SigningMethodES256, "k1", claims(func(c jwt.MapClaims) { delete(c, "sub") }), key), wantErr: "no sub claim"},
+		{name: "unknown kid", token: sign(jwt.SigningMethodES256, "k2", claims(nil), key), wantErr: "unknown key id"},
+		{name: "other key", token: sign(jwt.SigningMethodES256, "k1", claims(nil), other), wantErr: "signature is invalid"},
+		{name: "alg none", token: sign(jwt.SigningMethodNone, "k1", claims(nil), jwt.UnsafeAllowNoneSignatureType), wantErr: "signing method none is invalid"},
+		{name: "HS256", token: sign(jwt.SigningMethodHS256, "k1", claims(nil), []byte("secret")), wantErr: "signing method HS256 is invalid"},
+		{name: "not a jwt", token: "static-token", wantErr: errNoCredentials.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/mcp", nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+			id, err := j.authenticate(r)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			case tc.wantErr == "" && (id.Name != "grafana" || id.Method != "jwt"):
+				t.Fatalf("got identity %+v, expected grafana authenticated by jwt", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MTLSConfig configures the authentication of callers by their TLS client
+// certificates, whose identity is their common name, or else their first DNS
+// name or email address.
+type MTLSConfig struct {
+	// ClientCAFile holds the CA certificates client certificates must be
+	// signed by.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type mtlsAuthenticator struct {
+	// roots returns the latest CA certificates, which are reloaded along with
+	// those of TLS.
+	roots func() *x509.CertPool
+}
+
+func newMTLSAuthenticator(cfg MTLSConfig, roots func() *x509.CertPool) (*mtlsAuthenticator, error) {
+	if cfg.ClientCAFile == "" {
+		return nil, errors.New("mtls authentication needs a client_ca_file")
+	}
+	if roots == nil {
+		return nil, errors.New("mtls authentication needs TLS to be configured, so that clients are asked for certificates")
+	}
+	return &mtlsAuthenticator{roots: roots}, nil
+}
+
+func (m *mtlsAuthenticator) authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, errNoCredentials
+	}
+
+	// The certificate is verified here rather than relying on the TLS
+	// configuration of the listener, which may accept other certificates.
+	leaf := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         m.roots(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	name := leaf.Subject.CommonName
+	switch {
+	case name != "":
+	case len(leaf.DNSNames) > 0:
+		name = leaf.DNSNames[0]
+	case len(leaf.EmailAddresses) > 0:
+		name = leaf.EmailAddresses[0]
+	default:
+		return nil, errors.New("invalid client certificate: no common name, DNS name or email address")
+	}
+	return &Identity{Name: name, Method: "mtls"}, nil
+}
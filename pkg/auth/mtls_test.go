@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA returns a self-signed CA, and a function issuing client certificates
+// signed by it.
+func testCA(t *testing.T, name string) (*x509.Certificate, func(subject pkix.Name, usage x509.ExtKeyUsage) *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := int64(1)
+	return ca, func(subject pkix.Name, usage x509.ExtKeyUsage) *x509.Certificate {
+		t.Helper()
+		leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial++
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      subject,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, ca, &leafKey.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf
+	}
+}
+
+func TestMTLSAuthenticate(t *testing.T) {
+	ca, issue := testCA(t, "ca")
+	_, issueOther := testCA(t, "other")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	m, err := newMTLSAuthenticator(MTLSConfig{ClientCAFile: "ca.pem"}, func() *x509.CertPool { return roots })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		cert     *x509.Certificate
+		wantName string
+		wantErr  string
+	}{
+		{name: "common name", cert: issue(pkix.Name{CommonName: "grafana"}, x509.ExtKeyUsageClientAuth), wantName: "grafana"},
+		{name: "other CA", cert: issueOther(pkix.Name{CommonName: "grafana"}, x509.ExtKeyUsageClientAuth), wantErr: "invalid client certificate"},
+		{name: "server certificate", cert: issue(pkix.Name{CommonName: "grafana"}, x509.ExtKeyUsageServerAuth), wantErr: "invalid client certificate"},
+		{name: "no name", cert: issue(pkix.Name{}, x509.ExtKeyUsageClientAuth), wantErr: "no common name"},
+		{name: "no certificate", wantErr: errNoCredentials.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/mcp", nil)
+			r.TLS = &tls.ConnectionState{}
+			if tc.cert != nil {
+				r.TLS.PeerCertificates = []*x509.Certificate{tc.cert}
+			}
+			id, err := m.authenticate(r)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			case tc.wantErr == "" && (id.Name != tc.wantName || id.Method != "mtls"):
+				t.Fatalf("got identity %+v, expected %s authenticated by mtls", id, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestMTLSNeedsTLS(t *testing.T) {
+	if _, err := NewAuthenticator(Config{MTLS: &MTLSConfig{ClientCAFile: "ca.pem"}}, nil); err == nil {
+		t.Fatal("expected mtls authentication without TLS to be rejected")
+	}
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+// Policy allows the identities it applies to to use the given tools, prompts,
+// datasources and tenants. All of them are glob patterns, e.g. prometheus_*,
+// and empty lists allow everything. Resources are allowed on the datasources
+// and tenants of the policy.
+type Policy struct {
+	Identities  []string `yaml:"identities"`
+	Tools       []string `yaml:"tools"`
+	Prompts     []string `yaml:"prompts"`
+	Datasources []string `yaml:"datasources"`
+	Tenants     []string `yaml:"tenants"`
+}
+
+func (p Policy) appliesTo(id *Identity) bool {
+	return len(p.Identities) == 0 || matchAny(p.Identities, id.Name)
+}
+
+// allows returns whether the policy allows the tool or prompt name, if not
+// empty, against the datasource, if not empty, and tenant. Requests against a
+// multi-tenant datasource without a tenant are only allowed if the policy
+// doesn't restrict tenants.
+func (p Policy) allows(patterns []string, name, datasource, tenant string, multitenant bool) bool {
+	return (name == "" || len(patterns) == 0 || matchAny(patterns, name)) &&
+		(datasource == "" || len(p.Datasources) == 0 || matchAny(p.Datasources, datasource)) &&
+		(len(p.Tenants) == 0 || (tenant == "" && !multitenant) || matchAny(p.Tenants, tenant))
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer enforces policies on what the identities in the contexts of
+// requests may use. Requests without an identity, e.g. over stdio, are not
+// restricted.
+type Authorizer struct {
+	policies []Policy
+	backends *backend.Set
+}
+
+// NewAuthorizer returns an authorizer enforcing policies on the use of
+// backends.
+func NewAuthorizer(policies []Policy, backends *backend.Set) (*Authorizer, error) {
+	for i, p := range policies {
+		for _, patterns := range [][]string{p.Identities, p.Tools, p.Prompts, p.Datasources, p.Tenants} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("policy %d: invalid pattern %q: %w", i, pattern, err)
+				}
+			}
+		}
+	}
+	return &Authorizer{policies: policies, backends: backends}, nil
+}
+
+// allowed returns whether the identity of ctx may use the tool or prompt name
+// against the datasource and tenant. kind selects the patterns of policies the
+// name is matched against.
+func (a *Authorizer) allowed(ctx context.Context, kind func(Policy) []string, name, datasource, tenant string) bool {
+	id, ok := IdentityFromContext(ctx)
+	if !ok || len(a.policies) == 0 {
+		return true
+	}
+	datasource, tenant, multitenant := a.target(ctx, datasource, tenant)
+	for _, p := range a.policies {
+		var patterns []string
+		if kind != nil {
+			patterns = kind(p)
+		}
+		if p.appliesTo(id) && p.allows(patterns, name, datasource, tenant, multitenant) {
+			return true
+		}
+	}
+	return false
+}
+
+// target resolves the datasource and tenant requests are sent to when they
+// aren't set, and whether the datasource is multi-tenant.
+func (a *Authorizer) target(ctx context.Context, datasource, tenant string) (string, string, bool) {
+	b, err := a.backends.Get(datasource)
+	if err != nil {
+		// The request fails anyway, but is only allowed to if the policy
+		// allows its datasource.
+		return datasource, tenant, false
+	}
+	if !b.Multitenant() {
+		return b.Name, "", false
+	}
+	if tenant == "" {
+		tenant = b.Tenant(ctx)
+	}
+	return b.Name, tenant, true
+}
+
+func tools(p Policy) []string   { return p.Tools }
+func prompts(p Policy) []string { return p.Prompts }
+
+func denied(ctx context.Context, what string) string {
+	name := ""
+	if id, ok := IdentityFromContext(ctx); ok {
+		name = id.Name
+	}
+	return fmt.Sprintf("permission denied: %s is not allowed to use %s", name, what)
+}
+
+func target(what, datasource, tenant string) string {
+	if datasource != "" {
+		what += " on the datasource " + datasource
+	}
+	if tenant != "" {
+		what += " for the tenant " + tenant
+	}
+	return what
+}
+
+// ToolMiddleware rejects the tool calls the identity of the caller may not
+// make, given the tool and its datasource and tenant arguments.
+func (a *Authorizer) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			datasource, _ := args["datasource"].(string)
+			tenant, _ := args["tenant"].(string)
+			if !a.allowed(ctx, tools, request.Params.Name, datasource, tenant) {
+				return mcp.NewToolResultError(denied(ctx, target("the tool "+request.Params.Name, datasource, tenant))), nil
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// ToolFilter hides the tools the identity of the caller may not call.
+func (a *Authorizer) ToolFilter() server.ToolFilterFunc {
+	return func(ctx context.Context, ts []mcp.Tool) []mcp.Tool {
+		res := make([]mcp.Tool, 0, len(ts))
+		for _, t := range ts {
+			if a.anyAllowed(ctx, tools, t.Name) {
+				res = append(res, t)
+			}
+		}
+		return res
+	}
+}
+
+// PromptMiddleware rejects the prompts the identity of the caller may not
+// get, given the prompt and its datasource argument. Prompts whose datasource
+// argument isn't the name of a datasource, e.g. a Perses datasource, are
+// checked against the default datasource.
+func (a *Authorizer) PromptMiddleware() server.PromptHandlerMiddleware {
+	return func(next server.PromptHandlerFunc) server.PromptHandlerFunc {
+		return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			if err := a.checkPrompt(ctx, request.Params.Name, request.Params.Arguments["datasource"]); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func (a *Authorizer) checkPrompt(ctx context.Context, name, datasource string) error {
+	if _, err := a.backends.Get(datasource); err != nil {
+		datasource = ""
+	}
+	if !a.allowed(ctx, prompts, name, datasource, "") {
+		return fmt.Errorf("%s", denied(ctx, target("the prompt "+name, datasource, "")))
+	}
+	return nil
+}
+
+// PromptFilter hides the prompts the identity of the caller may not get.
+func (a *Authorizer) PromptFilter() server.PromptFilterFunc {
+	return func(ctx context.Context, ps []mcp.Prompt) []mcp.Prompt {
+		res := make([]mcp.Prompt, 0, len(ps))
+		for _, p := range ps {
+			if a.anyAllowed(ctx, prompts, p.Name) {
+				res = append(res, p)
+			}
+		}
+		return res
+	}
+}
+
+// ResourceMiddleware rejects reading the resources of the datasources the
+// identity of the caller may not use.
+func (a *Authorizer) ResourceMiddleware() server.ResourceHandlerMiddleware {
+	return func(next server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+		return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			if err := a.checkResource(ctx, request.Params.URI); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func (a *Authorizer) checkResource(ctx context.Context, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if !a.allowed(ctx, nil, "", u.Host, "") {
+		return fmt.Errorf("%s", denied(ctx, "the resources of the datasource "+u.Host))
+	}
+	return nil
+}
+
+// Register adds hooks to hooks, which must be passed to the MCP server, that
+// hide the resources and resource templates of the datasources the identity
+// of the caller may not use, for which there are no filters like for tools and
+// prompts, and reject subscriptions to them, which unlike reads go through no
+// middleware.
+func (a *Authorizer) Register(hooks *server.Hooks) {
+	hooks.AddAfterListResources(func(ctx context.Context, _ any, _ *mcp.ListResourcesRequest, result *mcp.ListResourcesResult) {
+		result.Resources = slices.DeleteFunc(result.Resources, func(r mcp.Resource) bool {
+			return a.checkResource(ctx, r.URI) != nil
+		})
+	})
+	hooks.AddAfterListResourceTemplates(func(ctx context.Context, _ any, _ *mcp.ListResourceTemplatesRequest, result *mcp.ListResourceTemplatesResult) {
+		result.ResourceTemplates = slices.DeleteFunc(result.ResourceTemplates, func(t mcp.ResourceTemplate) bool {
+			return t.URITemplate == nil || a.checkResource(ctx, t.URITemplate.Raw()) != nil
+		})
+	})
+	hooks.AddOnRequestInitialization(func(ctx context.Context, _ any, message any) error {
+		raw, ok := message.(json.RawMessage)
+		if !ok {
+			return nil
+		}
+		var request struct {
+			Method mcp.MCPMethod `json:"method"`
+			Params struct {
+				URI string `json:"uri"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(raw, &request); err != nil || request.Method != mcp.MethodResourcesSubscribe {
+			return nil
+		}
+		return a.checkResource(ctx, request.Params.URI)
+	})
+}
+
+// PromptCompletionProvider wraps next, so that it only completes the
+// arguments of the prompts the identity of the caller may get, and only
+// completes the datasources it may get them against.
+func (a *Authorizer) PromptCompletionProvider(next server.PromptCompletionProvider) server.PromptCompletionProvider {
+	return promptCompletionFunc(func(ctx context.Context, name string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+		if err := a.checkPrompt(ctx, name, cctx.Arguments["datasource"]); err != nil {
+			return nil, err
+		}
+		c, err := next.CompletePromptArgument(ctx, name, argument, cctx)
+		if err != nil || c == nil || argument.Name != "datasource" {
+			return c, err
+		}
+		values := make([]string, 0, len(c.Values))
+		for _, v := range c.Values {
+			if a.allowed(ctx, prompts, name, v, "") {
+				values = append(values, v)
+			}
+		}
+		c.Values, c.Total = values, len(values)
+		return c, nil
+	})
+}
+
+// ResourceCompletionProvider wraps next, so that it only completes the
+// variables of the resource templates of the datasources the identity of the
+// caller may use.
+func (a *Authorizer) ResourceCompletionProvider(next server.ResourceCompletionProvider) server.ResourceCompletionProvider {
+	return resourceCompletionFunc(func(ctx context.Context, uri string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+		if err := a.checkResource(ctx, uri); err != nil {
+			return nil, err
+		}
+		return next.CompleteResourceArgument(ctx, uri, argument, cctx)
+	})
+}
+
+type promptCompletionFunc func(ctx context.Context, name string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error)
+
+func (f promptCompletionFunc) CompletePromptArgument(ctx context.Context, name string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+	return f(ctx, name, argument, cctx)
+}
+
+type resourceCompletionFunc func(ctx context.Context, uri string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error)
+
+func (f resourceCompletionFunc) CompleteResourceArgument(ctx context.Context, uri string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+	return f(ctx, uri, argument, cctx)
+}
+
+// anyAllowed returns whether the identity of ctx may use the tool or prompt
+// name against any datasource.
+func (a *Authorizer) anyAllowed(ctx context.Context, kind func(Policy) []string, name string) bool {
+	id, ok := IdentityFromContext(ctx)
+	if !ok || len(a.policies) == 0 {
+		return true
+	}
+	for _, p := range a.policies {
+		if p.appliesTo(id) && (len(kind(p)) == 0 || matchAny(kind(p), name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+func testAuthorizer(t *testing.T, policies []Policy) *Authorizer {
+	t.Helper()
+	backends, err := backend.NewSet([]backend.Config{
+		{Name: "prometheus", URL: "http://localhost:9090"},
+		{Name: "thanos", URL: "http://thanos:9090", TenantHeader: "THANOS-TENANT"},
+		{Name: "mimir", URL: "http://mimir:9090", TenantHeader: "X-Scope-OrgID", Tenant: "team-a"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAuthorizer(policies, backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAllowed(t *testing.T) {
+	a := testAuthorizer(t, []Policy{
+		{Identities: []string{"admin"}},
+		{
+			Identities:  []string{"*@team-a.example.com"},
+			Tools:       []string{"prometheus_*"},
+			Datasources: []string{"thanos", "mimir"},
+			Tenants:     []string{"team-a"},
+		},
+		{Identities: []string{"grafana"}, Tools: []string{"promql_*"}, Datasources: []string{"prometheus"}},
+	})
+
+	for _, tc := range []struct {
+		name       string
+		identity   string
+		tool       string
+		datasource string
+		tenant     string
+		want       bool
+	}{
+		{name: "unrestricted identity", identity: "admin", tool: "prometheus_query", datasource: "thanos", tenant: "team-b", want: true},
+		{name: "tool and tenant allowed by globs", identity: "alice@team-a.example.com", tool: "prometheus_query", datasource: "thanos", tenant: "team-a", want: true},
+		{name: "tool denied", identity: "alice@team-a.example.com", tool: "promql_verify_selectors", datasource: "thanos", tenant: "team-a"},
+		{name: "datasource denied", identity: "alice@team-a.example.com", tool: "prometheus_query", datasource: "prometheus"},
+		{name: "default datasource denied", identity: "alice@team-a.example.com", tool: "prometheus_query"},
+		{name: "tenant denied", identity: "alice@team-a.example.com", tool: "prometheus_query", datasource: "thanos", tenant: "team-b"},
+		{name: "empty tenant without default denied", identity: "alice@team-a.example.com", tool: "prometheus_query", datasource: "thanos"},
+		{name: "empty tenant with allowed default", identity: "alice@team-a.example.com", tool: "prometheus_query", datasource: "mimir", want: true},
+		{name: "single-tenant datasource", identity: "grafana", tool: "promql_verify_selectors", datasource: "prometheus", want: true},
+		{name: "identity without policy", identity: "bob@team-b.example.com", tool: "prometheus_query", datasource: "thanos", tenant: "team-a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithIdentity(context.Background(), &Identity{Name: tc.identity})
+			if got := a.allowed(ctx, tools, tc.tool, tc.datasource, tc.tenant); got != tc.want {
+				t.Errorf("got allowed %v, expected %v", got, tc.want)
+			}
+		})
+	}
+
+	if !a.allowed(context.Background(), tools, "prometheus_query", "thanos", "") {
+		t.Error("requests without an identity, e.g. over stdio, must not be restricted")
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	if _, err := NewAuthorizer([]Policy{{Tools: []string{"["}}}, nil); err == nil {
+		t.Fatal("expected an invalid pattern to be rejected")
+	}
+}
+
+type staticCompleter []string
+
+func (c staticCompleter) CompletePromptArgument(context.Context, string, mcp.CompleteArgument, mcp.CompleteContext) (*mcp.Completion, error) {
+	return &mcp.Completion{Values: c, Total: len(c)}, nil
+}
+
+func (c staticCompleter) CompleteResourceArgument(context.Context, string, mcp.CompleteArgument, mcp.CompleteContext) (*mcp.Completion, error) {
+	return &mcp.Completion{Values: c, Total: len(c)}, nil
+}
+
+func TestCompletionAndSubscriptions(t *testing.T) {
+	a := testAuthorizer(t, []Policy{{Identities: []string{"grafana"}, Datasources: []string{"mimir"}}})
+	ctx := WithIdentity(context.Background(), &Identity{Name: "grafana"})
+	names := staticCompleter{"prometheus", "thanos", "mimir"}
+
+	prompts := a.PromptCompletionProvider(names)
+	c, err := prompts.CompletePromptArgument(ctx, "slo_report", mcp.CompleteArgument{Name: "datasource"}, mcp.CompleteContext{Arguments: map[string]string{"datasource": "mimir"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Values) != 1 || c.Values[0] != "mimir" || c.Total != 1 {
+		t.Errorf("got datasources %v, expected only mimir", c.Values)
+	}
+	if _, err := prompts.CompletePromptArgument(ctx, "slo_report", mcp.CompleteArgument{Name: "metric"}, mcp.CompleteContext{Arguments: map[string]string{"datasource": "thanos"}}); err == nil {
+		t.Error("expected completions against a denied datasource to be rejected")
+	}
+
+	resources := a.ResourceCompletionProvider(names)
+	if _, err := resources.CompleteResourceArgument(ctx, "prometheus://thanos/metric/{name}", mcp.CompleteArgument{Name: "name"}, mcp.CompleteContext{}); err == nil {
+		t.Error("expected completions of the resources of a denied datasource to be rejected")
+	}
+	if _, err := resources.CompleteResourceArgument(ctx, "prometheus://mimir/metric/{name}", mcp.CompleteArgument{Name: "name"}, mcp.CompleteContext{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	hooks := &server.Hooks{}
+	a.Register(hooks)
+	subscribe := func(uri string) error {
+		msg, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": mcp.MethodResourcesSubscribe, "params": map[string]string{"uri": uri}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hooks.OnRequestInitialization[0](ctx, 1, json.RawMessage(msg))
+	}
+	if err := subscribe("prometheus://thanos/alerts"); err == nil {
+		t.Error("expected subscriptions to the resources of a denied datasource to be rejected")
+	}
+	if err := subscribe("prometheus://mimir/alerts"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestListResources(t *testing.T) {
+	a := testAuthorizer(t, []Policy{{Identities: []string{"grafana"}, Datasources: []string{"mimir"}}})
+	hooks := &server.Hooks{}
+	a.Register(hooks)
+
+	for _, tc := range []struct {
+		name     string
+		identity string
+		want     []string
+	}{
+		{name: "restricted identity", identity: "grafana", want: []string{"prometheus://mimir/metrics"}},
+		{name: "identity without policy", identity: "bob"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithIdentity(context.Background(), &Identity{Name: tc.identity})
+			resources := &mcp.ListResourcesResult{Resources: []mcp.Resource{
+				mcp.NewResource("prometheus://prometheus/metrics", "prometheus metrics"),
+				mcp.NewResource("prometheus://mimir/metrics", "mimir metrics"),
+			}}
+			for _, hook := range hooks.OnAfterListResources {
+				hook(ctx, 1, &mcp.ListResourcesRequest{}, resources)
+			}
+			var got []string
+			for _, r := range resources.Resources {
+				got = append(got, r.URI)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got resources %v, expected %v", got, tc.want)
+			}
+
+			templates := &mcp.ListResourceTemplatesResult{ResourceTemplates: []mcp.ResourceTemplate{
+				mcp.NewResourceTemplate("prometheus://thanos/label/{name}/values", "thanos label values"),
+				mcp.NewResourceTemplate("prometheus://mimir/label/{name}/values", "mimir label values"),
+			}}
+			for _, hook := range hooks.OnAfterListResourceTemplates {
+				hook(ctx, 1, &mcp.ListResourceTemplatesRequest{}, templates)
+			}
+			if len(templates.ResourceTemplates) != len(tc.want) {
+				t.Errorf("got %d resource templates, expected %d", len(templates.ResourceTemplates), len(tc.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/cache"
+	"github.com/saswatamcode/promql-mcp/pkg/cost"
+	"github.com/saswatamcode/promql-mcp/pkg/environment"
+	"github.com/saswatamcode/promql-mcp/pkg/guard"
+)
+
+// Config configures a single Prometheus-compatible backend, also referred to as
+// a datasource.
+type Config struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// TenantHeader is the HTTP header used to select a tenant on multi-tenant
+	// backends, e.g. X-Scope-OrgID for Cortex and Mimir or THANOS-TENANT for
+	// Thanos.
+	TenantHeader string `yaml:"tenant_header,omitempty"`
+	// Tenant is the tenant used when a request doesn't select one.
+	Tenant string       `yaml:"tenant,omitempty"`
+	Limits guard.Limits `yaml:"limits"`
+	// AlertPollInterval is how often the firing alerts of the backend are
+	// polled to notify subscribers of its alerts resource. Zero disables it.
+	AlertPollInterval model.Duration `yaml:"alert_poll_interval"`
+	// EnvironmentRefreshInterval is how often the environment of the backend,
+	// e.g. its flavour and scrape interval, is discovered again. Zero only
+	// discovers it at startup.
+	EnvironmentRefreshInterval model.Duration `yaml:"environment_refresh_interval"`
+}
+
+const (
+	// DefaultAlertPollInterval is the alert poll interval of backends that
+	// don't configure one.
+	DefaultAlertPollInterval = model.Duration(30 * time.Second)
+	// DefaultEnvironmentRefreshInterval is the environment refresh interval of
+	// backends that don't configure one.
+	DefaultEnvironmentRefreshInterval = model.Duration(10 * time.Minute)
+	// DefaultScrapeInterval is the scrape interval assumed to estimate the cost
+	// of queries against backends that neither configure one nor have had
+	// theirs discovered.
+	DefaultScrapeInterval = 30 * time.Second
+)
+
+func (c *Config) UnmarshalYAML(unmarshal func(any) error) error {
+	*c = Config{
+		Limits:                     guard.DefaultLimits,
+		AlertPollInterval:          DefaultAlertPollInterval,
+		EnvironmentRefreshInterval: DefaultEnvironmentRefreshInterval,
+	}
+	type plain Config
+	return unmarshal((*plain)(c))
+}
+
+// Backend is a configured Prometheus-compatible backend along with everything
+// needed to make requests against it within its limits.
+type Backend struct {
+	Name string
+	// Client makes requests against the backend, enforcing the concurrency and
+	// timeout limits and setting the tenant header.
+	Client    api.Client
+	Guard     *guard.Guard
+	Estimator *cost.Estimator
+
+	AlertPollInterval          time.Duration
+	EnvironmentRefreshInterval time.Duration
+
+	url           string
+	environment   atomic.Pointer[environment.Environment]
+	tenantHeader  string
+	defaultTenant string
+	cache         *cache.Cache
+	observers     []Observer
+}
+
+// Observer observes the requests made against backends, e.g. to instrument
+// them.
+type Observer interface {
+	// RoundTripper wraps the round tripper that requests against the backend
+	// named datasource are sent with.
+	RoundTripper(datasource string, next http.RoundTripper) http.RoundTripper
+	// ObserveCache is called with the outcome of every cache lookup of a
+	// discovery request of the given kind, e.g. series, against the backend
+	// named datasource.
+	ObserveCache(ctx context.Context, datasource, kind string, hit bool)
+}
+
+// New returns a backend for the given configuration. Discovery results are
+// cached in c, which may be nil to disable caching, and requests are observed
+// by observers.
+func New(cfg Config, c *cache.Cache, observers ...Observer) (*Backend, error) {
+	rt := api.DefaultRoundTripper
+	for _, o := range observers {
+		rt = o.RoundTripper(cfg.Name, rt)
+	}
+	client, err := api.NewClient(api.Config{
+		Address:      cfg.URL,
+		RoundTripper: rt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating client for datasource %q: %w", cfg.Name, err)
+	}
+
+	g, err := guard.New(cfg.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("datasource %q: %w", cfg.Name, err)
+	}
+
+	b := &Backend{
+		Name:                       cfg.Name,
+		Guard:                      g,
+		AlertPollInterval:          time.Duration(cfg.AlertPollInterval),
+		EnvironmentRefreshInterval: time.Duration(cfg.EnvironmentRefreshInterval),
+		url:                        cfg.URL,
+		tenantHeader:               cfg.TenantHeader,
+		defaultTenant:              cfg.Tenant,
+		cache:                      c,
+		observers:                  observers,
+	}
+	b.Client = g.Client(&tenantClient{Client: client, b: b})
+	b.Estimator = cost.NewEstimator(b.Client, b.ScrapeInterval, cost.Limits{
+		MaxSeries:  cfg.Limits.MaxQuerySeries,
+		MaxSamples: cfg.Limits.MaxQuerySamples,
+	})
+	return b, nil
+}
+
+// ScrapeInterval returns the scrape interval used to estimate the cost of
+// queries: the configured one, else the discovered global one, else
+// DefaultScrapeInterval.
+func (b *Backend) ScrapeInterval() time.Duration {
+	if i := time.Duration(b.Guard.Limits().ScrapeInterval); i > 0 {
+		return i
+	}
+	if env := b.Environment(); env != nil && env.ScrapeInterval > 0 {
+		return env.ScrapeInterval
+	}
+	return DefaultScrapeInterval
+}
+
+// Multitenant returns whether requests against the backend can select a tenant.
+func (b *Backend) Multitenant() bool {
+	return b.tenantHeader != ""
+}
+
+// Tenant returns the tenant that requests made with ctx are sent for, or an
+// empty string if the backend isn't multi-tenant.
+func (b *Backend) Tenant(ctx context.Context) string {
+	if !b.Multitenant() {
+		return ""
+	}
+	if t, ok := ctx.Value(tenantKey{}).(string); ok && t != "" {
+		return t
+	}
+	return b.defaultTenant
+}
+
+// DefaultTenant returns the tenant that requests are sent for unless they
+// select one, or an empty string if the backend isn't multi-tenant.
+func (b *Backend) DefaultTenant() string {
+	if !b.Multitenant() {
+		return ""
+	}
+	return b.defaultTenant
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context that makes requests against the backend for the
+// given tenant.
+func (b *Backend) WithTenant(ctx context.Context, tenant string) (context.Context, error) {
+	if tenant == "" {
+		return ctx, nil
+	}
+	if !b.Multitenant() {
+		return nil, fmt.Errorf("datasource %q is not multi-tenant, do not set a tenant for it", b.Name)
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant), nil
+}
+
+type tenantClient struct {
+	api.Client
+	b *Backend
+}
+
+func (c *tenantClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	if t := c.b.Tenant(ctx); t != "" {
+		req.Header.Set(c.b.tenantHeader, t)
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// Set is the set of configured backends. The first backend is the default one,
+// used when a request doesn't name one.
+type Set struct {
+	backends []*Backend
+}
+
+// NewSet returns the set of backends for the given configurations, which all
+// share the cache c and the observers.
+func NewSet(cfgs []Config, c *cache.Cache, observers ...Observer) (*Set, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no datasources configured")
+	}
+
+	s := &Set{}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("datasource with url %q has no name", cfg.URL)
+		}
+		if slices.Contains(s.Names(), cfg.Name) {
+			return nil, fmt.Errorf("datasource %q is configured more than once", cfg.Name)
+		}
+		b, err := New(cfg, c, observers...)
+		if err != nil {
+			return nil, err
+		}
+		s.backends = append(s.backends, b)
+	}
+	return s, nil
+}
+
+// Get returns the backend with the given name, or the default one if name is
+// empty.
+func (s *Set) Get(name string) (*Backend, error) {
+	if name == "" {
+		return s.backends[0], nil
+	}
+	for _, b := range s.backends {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown datasource %q, available datasources are: %v", name, s.Names())
+}
+
+func (s *Set) All() []*Backend {
+	return s.backends
+}
+
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.backends))
+	for _, b := range s.backends {
+		names = append(names, b.Name)
+	}
+	return names
+}
@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/cache"
+)
+
+// Result is the result of a discovery request against a backend, which may have
+// been served from the cache.
+type Result[T any] struct {
+	Value T
+	cache.Status
+}
+
+// CacheNote returns a short note on where the result came from, to be added to
+// tool results, or an empty string if it was freshly fetched.
+func (r Result[T]) CacheNote() string {
+	if !r.Hit {
+		return ""
+	}
+	return fmt.Sprintf("(served from cache, fetched %s ago)", time.Since(r.FetchedAt).Round(time.Second))
+}
+
+func (b *Backend) cacheKey(ctx context.Context, kind string, parts ...any) string {
+	key := []string{b.Name, b.Tenant(ctx), kind}
+	for _, p := range parts {
+		if t, ok := p.(time.Time); ok {
+			p = b.cache.Bucket(t).Unix()
+		}
+		key = append(key, fmt.Sprint(p))
+	}
+	return strings.Join(key, "\x00")
+}
+
+// fetch returns the cached result of a discovery request of the given kind, or
+// calls fetch to get it, see cache.Cache.Fetch. The request is identified by
+// the kind and the parts of its key.
+func (b *Backend) fetch(ctx context.Context, kind string, key []any, fetch func(ctx context.Context) (any, error), size func(any) int) (any, cache.Status, error) {
+	v, status, err := b.cache.Fetch(ctx, b.cacheKey(ctx, kind, key...), fetch, size)
+	if err == nil && b.cache != nil {
+		for _, o := range b.observers {
+			o.ObserveCache(ctx, b.Name, kind, status.Hit)
+		}
+	}
+	return v, status, err
+}
+
+func logWarnings(warnings v1.Warnings) {
+	if len(warnings) > 0 {
+		slog.Warn("Prometheus warnings", "warnings", warnings)
+	}
+}
+
+// Series returns the series matching any of matches between start and end,
+// returning at most limit series if it is non-zero.
+func (b *Backend) Series(ctx context.Context, matches []string, start, end time.Time, limit uint64) (Result[[]model.LabelSet], error) {
+	v, status, err := b.fetch(ctx, "series", []any{matches, start, end, limit}, func(ctx context.Context) (any, error) {
+		lblSets, warnings, err := v1.NewAPI(b.Client).Series(ctx, matches, start, end, v1.WithLimit(limit))
+		logWarnings(warnings)
+		return lblSets, err
+	}, func(v any) int {
+		size := 0
+		for _, lblSet := range v.([]model.LabelSet) {
+			for n, v := range lblSet {
+				size += len(n) + len(v)
+			}
+		}
+		return size
+	})
+	if err != nil {
+		return Result[[]model.LabelSet]{}, err
+	}
+	return Result[[]model.LabelSet]{Value: v.([]model.LabelSet), Status: status}, nil
+}
+
+// LabelNames returns the label names of the series matching any of matches
+// between start and end.
+func (b *Backend) LabelNames(ctx context.Context, matches []string, start, end time.Time) (Result[[]string], error) {
+	v, status, err := b.fetch(ctx, "label_names", []any{matches, start, end}, func(ctx context.Context) (any, error) {
+		names, warnings, err := v1.NewAPI(b.Client).LabelNames(ctx, matches, start, end)
+		logWarnings(warnings)
+		return names, err
+	}, func(v any) int {
+		size := 0
+		for _, n := range v.([]string) {
+			size += len(n)
+		}
+		return size
+	})
+	if err != nil {
+		return Result[[]string]{}, err
+	}
+	return Result[[]string]{Value: v.([]string), Status: status}, nil
+}
+
+// LabelValues returns the values of label on the series matching any of
+// matches between start and end, returning at most limit values if it is
+// non-zero.
+func (b *Backend) LabelValues(ctx context.Context, label string, matches []string, start, end time.Time, limit uint64) (Result[model.LabelValues], error) {
+	v, status, err := b.fetch(ctx, "label_values", []any{label, matches, start, end, limit}, func(ctx context.Context) (any, error) {
+		values, warnings, err := v1.NewAPI(b.Client).LabelValues(ctx, label, matches, start, end, v1.WithLimit(limit))
+		logWarnings(warnings)
+		return values, err
+	}, func(v any) int {
+		size := 0
+		for _, lv := range v.(model.LabelValues) {
+			size += len(lv)
+		}
+		return size
+	})
+	if err != nil {
+		return Result[model.LabelValues]{}, err
+	}
+	return Result[model.LabelValues]{Value: v.(model.LabelValues), Status: status}, nil
+}
+
+// TruncateValues drops the values past the series limit, which discovery
+// requests ask for one more than of to tell whether there are more.
+func (b *Backend) TruncateValues(values model.LabelValues) (model.LabelValues, bool) {
+	if b.Guard.CheckSeries(len(values)) == nil {
+		return values, false
+	}
+	return values[:b.Guard.Limits().MaxSeries], true
+}
+
+// Metadata returns the metadata of metric, or of every metric if it is empty,
+// returning at most limit metrics if it is non-empty.
+func (b *Backend) Metadata(ctx context.Context, metric, limit string) (Result[map[string][]v1.Metadata], error) {
+	v, status, err := b.fetch(ctx, "metadata", []any{metric, limit}, func(ctx context.Context) (any, error) {
+		return v1.NewAPI(b.Client).Metadata(ctx, metric, limit)
+	}, func(v any) int {
+		size := 0
+		for name, mds := range v.(map[string][]v1.Metadata) {
+			for _, md := range mds {
+				size += len(name) + len(md.Type) + len(md.Help) + len(md.Unit)
+			}
+		}
+		return size
+	})
+	if err != nil {
+		return Result[map[string][]v1.Metadata]{}, err
+	}
+	return Result[map[string][]v1.Metadata]{Value: v.(map[string][]v1.Metadata), Status: status}, nil
+}
+
+// NativeHistogramQuery is the query NativeHistogram probes metric with.
+func NativeHistogramQuery(metric string) string {
+	return fmt.Sprintf("count(histogram_count({%s=%q}))", model.MetricNameLabel, metric)
+}
+
+// NativeHistogram returns whether metric is a native histogram, by probing
+// whether histogram_count returns anything for it.
+func (b *Backend) NativeHistogram(ctx context.Context, metric string) (Result[bool], error) {
+	v, status, err := b.fetch(ctx, "native_histogram", []any{metric}, func(ctx context.Context) (any, error) {
+		value, warnings, err := v1.NewAPI(b.Client).Query(ctx, NativeHistogramQuery(metric), time.Now())
+		logWarnings(warnings)
+		if err != nil {
+			return false, err
+		}
+		vector, ok := value.(model.Vector)
+		return ok && len(vector) > 0, nil
+	}, func(v any) int {
+		return 1
+	})
+	if err != nil {
+		return Result[bool]{}, err
+	}
+	return Result[bool]{Value: v.(bool), Status: status}, nil
+}
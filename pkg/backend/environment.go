@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/saswatamcode/promql-mcp/pkg/environment"
+)
+
+// Environment returns the last discovered environment of the backend, or nil if
+// it hasn't been discovered yet.
+func (b *Backend) Environment() *environment.Environment {
+	return b.environment.Load()
+}
+
+// DiscoverEnvironment discovers the environment of the backend and probes its
+// capabilities, and keeps them to be returned by Environment. As they are
+// shared by every caller, they are discovered for the configured tenant,
+// whichever one ctx selects.
+func (b *Backend) DiscoverEnvironment(ctx context.Context) (*environment.Environment, error) {
+	ctx = context.WithValue(ctx, tenantKey{}, "")
+	api := v1.NewAPI(b.Client)
+	env, err := environment.Discover(ctx, api, b.url)
+	if err != nil {
+		return nil, err
+	}
+	env.Capabilities = environment.Probe(ctx, api)
+	b.environment.Store(env)
+	return env, nil
+}
+
+// RunEnvironmentDiscovery discovers the environment of the backend right away,
+// and then every EnvironmentRefreshInterval until ctx is canceled.
+func (b *Backend) RunEnvironmentDiscovery(ctx context.Context) error {
+	var tick <-chan time.Time
+	if b.EnvironmentRefreshInterval > 0 {
+		ticker := time.NewTicker(b.EnvironmentRefreshInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		env, err := b.DiscoverEnvironment(ctx)
+		if err != nil {
+			slog.Warn("error discovering environment", "datasource", b.Name, "error", err)
+		} else {
+			slog.Debug("discovered environment", "datasource", b.Name, "flavour", env.Flavour, "version", env.Version, "scrape_interval", env.ScrapeInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		}
+	}
+}
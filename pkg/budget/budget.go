@@ -0,0 +1,220 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultConfig is the budget of tool responses if none is configured.
+var DefaultConfig = Config{
+	MaxTokens: 10000,
+}
+
+// Config is the server-wide budget of tool responses. Zero values mean no
+// limit.
+type Config struct {
+	MaxTokens int `yaml:"max_tokens"`
+	MaxBytes  int `yaml:"max_bytes"`
+}
+
+// Budget bounds the size of a single tool response. Zero values mean no limit.
+type Budget struct {
+	MaxTokens int
+	MaxBytes  int
+}
+
+// Unlimited returns whether the budget doesn't bound anything.
+func (b Budget) Unlimited() bool {
+	return b.MaxTokens <= 0 && b.MaxBytes <= 0
+}
+
+// Fits returns whether s is within the budget.
+func (b Budget) Fits(s string) bool {
+	if b.MaxBytes > 0 && len(s) > b.MaxBytes {
+		return false
+	}
+	if b.MaxTokens > 0 && EstimateTokens(s) > b.MaxTokens {
+		return false
+	}
+	return true
+}
+
+func (b Budget) String() string {
+	var parts []string
+	if b.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", b.MaxTokens))
+	}
+	if b.MaxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d bytes", b.MaxBytes))
+	}
+	if len(parts) == 0 {
+		return "no limit"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Truncate returns s if it fits the budget, or else as many of its leading
+// lines as fit, or the start of its first line if none does, along with a note
+// on what was dropped. The note is shortened, or left out, rather than taking
+// up more than half of a small budget.
+func (b Budget) Truncate(s string) (string, bool) {
+	if b.Fits(s) {
+		return s, false
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	note := func(kept int) string {
+		if kept == 0 {
+			return fmt.Sprintf("\n[truncated: the response exceeded the budget of %s, so it was cut within its first line and the other %d of %d lines were dropped. Narrow down the request to see them.]", b, len(lines)-1, len(lines))
+		}
+		return fmt.Sprintf("\n[truncated: the response exceeded the budget of %s, so the last %d of %d lines were dropped. Narrow down the request to see them.]", b, len(lines)-kept, len(lines))
+	}
+	// Leave room for the note, which is at its longest when nothing is kept.
+	// Lines end at whitespace, so their tokens add up.
+	withinHalf := func(s string) bool {
+		return (b.MaxTokens <= 0 || EstimateTokens(s) <= b.MaxTokens/2) && (b.MaxBytes <= 0 || len(s) <= b.MaxBytes/2)
+	}
+	switch {
+	case withinHalf(note(0) + "\n"):
+	case withinHalf(shortNote + "\n"):
+		note = func(int) string { return shortNote }
+	default:
+		note = func(int) string { return "" }
+	}
+	longest := note(0) + "\n"
+	maxTokens, maxBytes := b.MaxTokens-EstimateTokens(longest), b.MaxBytes-len(longest)
+
+	var sb strings.Builder
+	kept, tokens := 0, 0
+	for _, l := range lines {
+		tokens += EstimateTokens(l)
+		if (b.MaxTokens > 0 && tokens > maxTokens) || (b.MaxBytes > 0 && sb.Len()+len(l) > maxBytes) {
+			break
+		}
+		sb.WriteString(l)
+		kept++
+	}
+	if kept == 0 {
+		sb.WriteString(b.cut(lines[0], maxTokens, maxBytes))
+	}
+	if !strings.HasSuffix(sb.String(), "\n") && sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(note(kept))
+	return sb.String(), true
+}
+
+// shortNote replaces the note of Truncate when it doesn't fit the budget.
+const shortNote = "\n[truncated]"
+
+// cut returns the longest prefix of line, ending at a rune boundary, within
+// maxTokens tokens and maxBytes bytes, for the limits that b sets.
+func (b Budget) cut(line string, maxTokens, maxBytes int) string {
+	if b.MaxBytes > 0 && len(line) > maxBytes {
+		n := max(0, maxBytes)
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		line = line[:n]
+	}
+	if b.MaxTokens <= 0 {
+		return line
+	}
+	// Token estimates grow with the length of the prefix, so search for the
+	// longest prefix that fits.
+	runes := []rune(line)
+	n := sort.Search(len(runes)+1, func(i int) bool {
+		return EstimateTokens(string(runes[:i])) > maxTokens
+	})
+	return string(runes[:max(0, n-1)])
+}
+
+// EstimateTokens approximates the number of tokens s would be split into by
+// the tokenizers of common models, without depending on any of them. Words
+// count as one token per four letters, numbers as one token per three digits,
+// and every other non-space character as a token of its own.
+func EstimateTokens(s string) int {
+	tokens := 0
+	letters, digits := 0, 0
+	flush := func() {
+		tokens += (letters+3)/4 + (digits+2)/3
+		letters, digits = 0, 0
+	}
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+type budgetKey struct{}
+
+// FromContext returns the budget of the tool call ctx belongs to.
+func FromContext(ctx context.Context) Budget {
+	b, _ := ctx.Value(budgetKey{}).(Budget)
+	return b
+}
+
+// Middleware bounds the responses of tools to the server-wide budget, which
+// tool calls can lower with their max_tokens and max_bytes arguments. The
+// budget of the call is available to the tool through FromContext, so that it
+// can degrade its response gracefully, and text responses still exceeding it
+// are truncated.
+func Middleware(cfg Config) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			b := Budget{MaxTokens: cfg.MaxTokens, MaxBytes: cfg.MaxBytes}
+			args := request.GetArguments()
+			b.MaxTokens = lower(b.MaxTokens, args["max_tokens"])
+			b.MaxBytes = lower(b.MaxBytes, args["max_bytes"])
+
+			res, err := next(context.WithValue(ctx, budgetKey{}, b), request)
+			if res == nil || b.Unlimited() {
+				return res, err
+			}
+			for i, c := range res.Content {
+				if t, ok := c.(mcp.TextContent); ok {
+					t.Text, _ = b.Truncate(t.Text)
+					res.Content[i] = t
+				}
+			}
+			return res, err
+		}
+	}
+}
+
+// lower returns the lowest of the configured limit and the one requested by a
+// tool call, if any, where zero means no limit.
+func lower(limit int, requested any) int {
+	r, ok := requested.(float64)
+	if !ok || r <= 0 {
+		return limit
+	}
+	if limit <= 0 || int(r) < limit {
+		return int(r)
+	}
+	return limit
+}
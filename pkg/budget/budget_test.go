@@ -0,0 +1,66 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	many := strings.Repeat("http_requests_total{job=\"api\"}\n", 100)
+	long := strings.Repeat("a long line without any line break ", 100)
+
+	for _, tc := range []struct {
+		name         string
+		s            string
+		budget       Budget
+		wantPrefix   string
+		wantContains string
+		wantTrunc    bool
+	}{
+		{name: "fits", s: "up\n", budget: Budget{MaxTokens: 10}, wantPrefix: "up\n"},
+		{name: "unlimited", s: many, budget: Budget{}, wantPrefix: many},
+		{name: "drops trailing lines by tokens", s: many, budget: Budget{MaxTokens: 500}, wantPrefix: "http_requests_total{job=\"api\"}\n", wantContains: "lines were dropped", wantTrunc: true},
+		{name: "drops trailing lines by bytes", s: many, budget: Budget{MaxBytes: 1000}, wantPrefix: "http_requests_total{job=\"api\"}\n", wantContains: "lines were dropped", wantTrunc: true},
+		{name: "cuts a single long line", s: long, budget: Budget{MaxTokens: 200}, wantPrefix: "a long line", wantContains: "cut within its first line", wantTrunc: true},
+		{name: "shortens the note of small budgets", s: many, budget: Budget{MaxTokens: 20}, wantPrefix: "http_requests", wantContains: "[truncated]", wantTrunc: true},
+		{name: "leaves out the note of tiny budgets", s: many, budget: Budget{MaxBytes: 10}, wantPrefix: "http_requ", wantTrunc: true},
+		{name: "cuts at rune boundaries", s: strings.Repeat("é", 100), budget: Budget{MaxBytes: 31}, wantPrefix: "éééééé", wantTrunc: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, truncated := tc.budget.Truncate(tc.s)
+			if truncated != tc.wantTrunc {
+				t.Errorf("got truncated %v, expected %v", truncated, tc.wantTrunc)
+			}
+			if !tc.budget.Fits(got) {
+				t.Errorf("result of %d bytes and %d tokens exceeds the budget of %s", len(got), EstimateTokens(got), tc.budget)
+			}
+			if !strings.HasPrefix(got, tc.wantPrefix) {
+				t.Errorf("expected the result to start with %q, got %q", tc.wantPrefix, got)
+			}
+			if !strings.Contains(got, tc.wantContains) {
+				t.Errorf("expected the result to contain %q, got %q", tc.wantContains, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("result is not valid UTF-8: %q", got)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want int
+	}{
+		{s: "", want: 0},
+		{s: "up", want: 1},
+		{s: "http_requests_total", want: 5},
+		{s: "12345", want: 2},
+		{s: `up{job="api"}`, want: 8},
+	} {
+		if got := EstimateTokens(tc.s); got != tc.want {
+			t.Errorf("EstimateTokens(%q) = %d, expected %d", tc.s, got, tc.want)
+		}
+	}
+}
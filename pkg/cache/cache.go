@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultConfig is the cache configuration used when none is given.
+var DefaultConfig = Config{
+	TTL:        model.Duration(time.Minute),
+	TimeBucket: model.Duration(time.Minute),
+	MaxEntries: 1000,
+	MaxBytes:   64 << 20,
+}
+
+// Config configures the cache of discovery results.
+type Config struct {
+	// TTL is how long results are cached for. A zero TTL disables caching.
+	TTL model.Duration `yaml:"ttl"`
+	// TimeBucket is the granularity that the time ranges of requests are rounded
+	// to, so that requests for e.g. the last hour made a few seconds apart share
+	// the same cached result.
+	TimeBucket model.Duration `yaml:"time_bucket"`
+	// MaxEntries is the maximum number of results cached at once.
+	MaxEntries int `yaml:"max_entries"`
+	// MaxBytes is the approximate maximum size of all cached results together.
+	MaxBytes int `yaml:"max_bytes"`
+}
+
+func (c *Config) UnmarshalYAML(unmarshal func(any) error) error {
+	*c = DefaultConfig
+	type plain Config
+	return unmarshal((*plain)(c))
+}
+
+// Cache is an in-memory cache with a TTL, evicting the least recently used
+// entries once it is full. Concurrent fetches of the same key are deduplicated,
+// so that only one of them goes upstream.
+type Cache struct {
+	cfg Config
+
+	mtx     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int
+
+	group singleflight.Group
+}
+
+type entry struct {
+	key       string
+	value     any
+	size      int
+	fetchedAt time.Time
+}
+
+// New returns a cache with the given configuration, or nil if the configuration
+// disables caching. A nil cache is valid and fetches every value.
+func New(cfg Config) *Cache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	return &Cache{
+		cfg:     cfg,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Bucket rounds t down to the time bucket of the cache, for use in keys.
+func (c *Cache) Bucket(t time.Time) time.Time {
+	if c == nil || c.cfg.TimeBucket <= 0 {
+		return t
+	}
+	return t.Truncate(time.Duration(c.cfg.TimeBucket))
+}
+
+// fetchTimeout bounds fetches, which are shared by concurrent identical
+// requests and so don't stop when the request that started them is canceled.
+// Backends normally time out their requests well before it.
+const fetchTimeout = time.Minute
+
+// Status describes where a value returned by Fetch came from.
+type Status struct {
+	// Hit is true if the value was served from the cache, or fetched by a
+	// concurrent identical request, rather than fetched for this request.
+	Hit       bool
+	FetchedAt time.Time
+}
+
+// Fetch returns the cached value for key, or calls fetch to get it and caches
+// the result. The size of the value, in bytes, is estimated with size.
+func (c *Cache) Fetch(ctx context.Context, key string, fetch func(ctx context.Context) (any, error), size func(any) int) (any, Status, error) {
+	if c == nil {
+		v, err := fetch(ctx)
+		return v, Status{FetchedAt: time.Now()}, err
+	}
+
+	if e, ok := c.get(key); ok {
+		return e.value, Status{Hit: true, FetchedAt: e.fetchedAt}, nil
+	}
+
+	// The fetch is detached from the context of whichever request starts it,
+	// so that canceling that request doesn't fail the others waiting for it,
+	// each of which waits on its own context instead.
+	leader := false
+	ch := c.group.DoChan(key, func() (any, error) {
+		leader = true
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+		v, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{key: key, value: v, size: size(v), fetchedAt: time.Now()}
+		c.set(e)
+		return e, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, Status{}, res.Err
+		}
+		e := res.Val.(*entry)
+		return e.value, Status{Hit: !leader, FetchedAt: e.fetchedAt}, nil
+	case <-ctx.Done():
+		return nil, Status{}, ctx.Err()
+	}
+}
+
+func (c *Cache) get(key string) (*entry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Since(e.fetchedAt) > time.Duration(c.cfg.TTL) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+func (c *Cache) set(e *entry) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.cfg.MaxBytes > 0 && e.size > c.cfg.MaxBytes {
+		return
+	}
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size
+
+	for (c.cfg.MaxEntries > 0 && c.lru.Len() > c.cfg.MaxEntries) || (c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes) {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func size(any) int { return 1 }
+
+func TestFetch(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		cfg       Config
+		keys      []string
+		wantCalls int
+		wantHits  []bool
+	}{
+		{
+			name:      "repeated key hits",
+			cfg:       Config{TTL: model.Duration(time.Minute)},
+			keys:      []string{"a", "a", "b", "a"},
+			wantCalls: 2,
+			wantHits:  []bool{false, true, false, true},
+		},
+		{
+			name:      "max entries evicts least recently used",
+			cfg:       Config{TTL: model.Duration(time.Minute), MaxEntries: 1},
+			keys:      []string{"a", "b", "a"},
+			wantCalls: 3,
+			wantHits:  []bool{false, false, false},
+		},
+		{
+			name:      "max bytes evicts least recently used",
+			cfg:       Config{TTL: model.Duration(time.Minute), MaxBytes: 2},
+			keys:      []string{"a", "b", "a", "c", "b"},
+			wantCalls: 4,
+			wantHits:  []bool{false, false, true, false, false},
+		},
+		{
+			name:      "expired entries are fetched again",
+			cfg:       Config{TTL: model.Duration(time.Nanosecond)},
+			keys:      []string{"a", "a"},
+			wantCalls: 2,
+			wantHits:  []bool{false, false},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(tc.cfg)
+			calls := 0
+			for i, key := range tc.keys {
+				time.Sleep(time.Millisecond)
+				v, status, err := c.Fetch(context.Background(), key, func(context.Context) (any, error) {
+					calls++
+					return key, nil
+				}, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v != key {
+					t.Errorf("fetch %d: got value %v, expected %v", i, v, key)
+				}
+				if status.Hit != tc.wantHits[i] {
+					t.Errorf("fetch %d of %q: got hit %v, expected %v", i, key, status.Hit, tc.wantHits[i])
+				}
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got %d fetches, expected %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFetchErrorsAreNotCached(t *testing.T) {
+	c := New(Config{TTL: model.Duration(time.Minute)})
+	if _, _, err := c.Fetch(context.Background(), "a", func(context.Context) (any, error) {
+		return nil, errors.New("unavailable")
+	}, size); err == nil {
+		t.Fatal("expected the error of the fetch")
+	}
+	v, status, err := c.Fetch(context.Background(), "a", func(context.Context) (any, error) {
+		return "a", nil
+	}, size)
+	if err != nil || v != "a" || status.Hit {
+		t.Fatalf("got %v, %+v, %v, expected the value to be fetched again", v, status, err)
+	}
+}
+
+func TestFetchNilCache(t *testing.T) {
+	c := New(Config{})
+	if c != nil {
+		t.Fatal("expected a zero TTL to disable the cache")
+	}
+	calls := 0
+	for range 2 {
+		if _, status, err := c.Fetch(context.Background(), "a", func(context.Context) (any, error) {
+			calls++
+			return "a", nil
+		}, size); err != nil || status.Hit {
+			t.Fatalf("got %+v, %v", status, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("got %d fetches, expected 2", calls)
+	}
+}
+
+// TestFetchConcurrent checks that concurrent fetches of the same key are only
+// sent upstream once, that only the requests that didn't fetch count as hits,
+// and that canceling the request that started the fetch doesn't fail the
+// others.
+func TestFetchConcurrent(t *testing.T) {
+	c := New(Config{TTL: model.Duration(time.Minute)})
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		close(started)
+		<-release
+		return "a", ctx.Err()
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, err := c.Fetch(leaderCtx, "a", fetch, size)
+		leaderErr <- err
+	}()
+	<-started
+
+	const waiters = 5
+	var wg sync.WaitGroup
+	var hits atomic.Int32
+	for range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, status, err := c.Fetch(context.Background(), "a", fetch, size)
+			if err != nil {
+				t.Errorf("waiter failed: %v", err)
+				return
+			}
+			if v != "a" {
+				t.Errorf("got value %v, expected a", v)
+			}
+			if status.Hit {
+				hits.Add(1)
+			}
+		}()
+	}
+
+	// Give the waiters time to join the fetch before canceling the request
+	// that started it.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the canceled request to fail with its own error, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d fetches, expected 1", n)
+	}
+	if n := hits.Load(); n != waiters {
+		t.Errorf("got %d hits, expected %d", n, waiters)
+	}
+}
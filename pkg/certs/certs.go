@@ -0,0 +1,209 @@
+// Package certs serves TLS certificates that are reloaded from disk whenever
+// they change, e.g. when they are renewed by cert-manager.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+
+	// DefaultReloadInterval is how often the files are checked for changes
+	// if no interval is configured.
+	DefaultReloadInterval = model.Duration(10 * time.Second)
+)
+
+// Config configures TLS termination. TLS is disabled if no certificate is
+// configured.
+type Config struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile holds the CA certificates client certificates are verified
+	// against, for mTLS.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is request to verify client certificates if they are given,
+	// so that clients may also authenticate with tokens, or require to
+	// require them. Defaults to request.
+	ClientAuth string `yaml:"client_auth"`
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval model.Duration `yaml:"reload_interval"`
+}
+
+// Enabled returns whether TLS is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Reloader holds the certificate and client CAs of the configuration, and
+// reloads them when their files change.
+type Reloader struct {
+	cfg              Config
+	authClientCAFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// clientCA are the CAs client certificates are verified against during
+	// the handshake, those of both files, and authClientCA those of mTLS
+	// authentication alone.
+	clientCA     *x509.CertPool
+	authClientCA *x509.CertPool
+	contents     []byte
+}
+
+// NewReloader loads the files of cfg, and authClientCAFile if it is set, which
+// holds the CA certificates of mTLS authentication. Client certificates signed
+// by those are asked for and accepted as well, to be verified by
+// authentication.
+func NewReloader(cfg Config, authClientCAFile string) (*Reloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("TLS needs both a cert_file and a key_file")
+	}
+	switch cfg.ClientAuth {
+	case "":
+		cfg.ClientAuth = ClientAuthRequest
+	case ClientAuthRequest, ClientAuthRequire:
+	default:
+		return nil, fmt.Errorf("unknown client_auth %q, expected request or require", cfg.ClientAuth)
+	}
+	if cfg.ClientAuth == ClientAuthRequire && cfg.ClientCAFile == "" && authClientCAFile == "" {
+		return nil, errors.New("requiring client certificates needs a client_ca_file")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = DefaultReloadInterval
+	}
+
+	r := &Reloader{cfg: cfg, authClientCAFile: authClientCAFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a TLS configuration that always serves the latest
+// certificate and verifies client certificates against the latest client CAs.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if r.clientCA != nil {
+				cfg.ClientCAs = r.clientCA
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.cfg.ClientAuth == ClientAuthRequire {
+					cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// AuthClientCAs returns the latest CAs of mTLS authentication, nil if no
+// authClientCAFile was given.
+func (r *Reloader) AuthClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.authClientCA
+}
+
+// Run reloads the files whenever they change, until ctx is canceled. Files
+// that fail to load are logged, and the previous ones kept.
+func (r *Reloader) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(r.cfg.ReloadInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				slog.Error("error reloading TLS certificates, keeping the previous ones", "error", err)
+				continue
+			}
+			if changed {
+				slog.Info("reloaded TLS certificates", "cert_file", r.cfg.CertFile)
+			}
+		}
+	}
+}
+
+// reload loads the files if their contents changed since they were last
+// loaded, returning whether they did.
+func (r *Reloader) reload() (bool, error) {
+	var contents [][]byte
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile, r.authClientCAFile} {
+		if f == "" {
+			contents = append(contents, nil)
+			continue
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return false, fmt.Errorf("reading %s: %w", f, err)
+		}
+		contents = append(contents, b)
+	}
+	all := bytes.Join(contents, []byte{0})
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(all, r.contents)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return false, fmt.Errorf("loading certificate %s: %w", r.cfg.CertFile, err)
+	}
+	clientCA, err := certPool([]string{r.cfg.ClientCAFile, r.authClientCAFile}, contents[2:])
+	if err != nil {
+		return false, err
+	}
+	authClientCA, err := certPool([]string{r.authClientCAFile}, contents[3:])
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.clientCA, r.authClientCA, r.contents = &cert, clientCA, authClientCA, all
+	return true, nil
+}
+
+// certPool returns a pool of the certificates of the given files, whose
+// contents are nil for files that aren't set, or nil if no file is.
+func certPool(files []string, contents [][]byte) (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	for i, f := range files {
+		if f == "" {
+			continue
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(contents[i]) {
+			return nil, fmt.Errorf("no certificates in client CA file %s", f)
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,135 @@
+package completion
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/prompts"
+)
+
+const (
+	// maxValues is the maximum number of values a completion may return, as
+	// set by the MCP specification.
+	maxValues = 100
+	// window is how far back to look for label values to complete.
+	window = time.Hour
+)
+
+// Provider completes prompt arguments and resource template variables using
+// the configured datasources and live label data from them.
+type Provider struct {
+	backends *backend.Set
+}
+
+func NewProvider(backends *backend.Set) *Provider {
+	return &Provider{backends: backends}
+}
+
+// CompletePromptArgument completes prompt arguments by their name, so that the
+// same argument completes the same way across every prompt.
+func (p *Provider) CompletePromptArgument(ctx context.Context, _ string, argument mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+	// Prompts may take a datasource argument that isn't one of ours, e.g. the
+	// Perses datasource of a dashboard, in which case use the default one.
+	b, err := p.backends.Get(cctx.Arguments["datasource"])
+	if err != nil {
+		b, _ = p.backends.Get("")
+	}
+
+	switch argument.Name {
+	case "datasource":
+		return complete(p.backends.Names(), argument.Value), nil
+	case "namespace", "namespace_or_project":
+		return p.labelValues(ctx, b, "namespace", argument.Value)
+	case "metric", "metric_name":
+		return p.labelValues(ctx, b, labels.MetricName, argument.Value)
+	case "alertname":
+		return p.labelValues(ctx, b, "alertname", argument.Value)
+	case "workload_kind":
+		return complete(prompts.WorkloadKinds(), argument.Value), nil
+	case "workload_name":
+		label, ok := prompts.WorkloadLabel(cctx.Arguments["workload_kind"])
+		if !ok {
+			return complete(nil, argument.Value), nil
+		}
+		var matches []string
+		if ns := cctx.Arguments["namespace"]; ns != "" {
+			matches = []string{fmt.Sprintf("{namespace=%q}", ns)}
+		}
+		return p.labelValues(ctx, b, label, argument.Value, matches...)
+	}
+	return complete(nil, argument.Value), nil
+}
+
+// CompleteResourceArgument completes the variables of the resource templates
+// of a datasource, i.e. prometheus://<datasource>/metric/{name} and
+// prometheus://<datasource>/label/{name}/values.
+func (p *Provider) CompleteResourceArgument(ctx context.Context, uri string, argument mcp.CompleteArgument, _ mcp.CompleteContext) (*mcp.Completion, error) {
+	ds, path, ok := strings.Cut(strings.TrimPrefix(uri, "prometheus://"), "/")
+	if !ok || argument.Name != "name" {
+		return complete(nil, argument.Value), nil
+	}
+	b, err := p.backends.Get(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(path, "metric/"):
+		return p.labelValues(ctx, b, labels.MetricName, argument.Value)
+	case strings.HasPrefix(path, "label/"):
+		end := time.Now()
+		names, err := b.LabelNames(ctx, nil, end.Add(-window), end)
+		if err != nil {
+			slog.Error("error querying Prometheus", "error", err)
+			return nil, fmt.Errorf("error querying Prometheus: %w", err)
+		}
+		return complete(names.Value, argument.Value), nil
+	}
+	return complete(nil, argument.Value), nil
+}
+
+func (p *Provider) labelValues(ctx context.Context, b *backend.Backend, label, prefix string, matches ...string) (*mcp.Completion, error) {
+	end := time.Now()
+	values, err := b.LabelValues(ctx, label, matches, end.Add(-window), end, b.Guard.SeriesLimit())
+	if err != nil {
+		slog.Error("error querying Prometheus", "error", err)
+		return nil, fmt.Errorf("error querying Prometheus: %w", err)
+	}
+	kept, truncated := b.TruncateValues(values.Value)
+
+	candidates := make([]string, 0, len(kept))
+	for _, v := range kept {
+		candidates = append(candidates, string(v))
+	}
+	c := complete(candidates, prefix)
+	// Values past the cut may match the prefix as well.
+	c.HasMore = c.HasMore || truncated
+	return c, nil
+}
+
+// complete returns the candidates that start with prefix, ignoring case.
+func complete(candidates []string, prefix string) *mcp.Completion {
+	prefix = strings.ToLower(prefix)
+
+	values := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), prefix) {
+			values = append(values, c)
+		}
+	}
+	sort.Strings(values)
+
+	c := &mcp.Completion{Values: values, Total: len(values)}
+	if len(values) > maxValues {
+		c.Values = values[:maxValues]
+		c.HasMore = true
+	}
+	return c
+}
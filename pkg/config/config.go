@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/saswatamcode/promql-mcp/pkg/audit"
+	"github.com/saswatamcode/promql-mcp/pkg/auth"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+	"github.com/saswatamcode/promql-mcp/pkg/cache"
+	"github.com/saswatamcode/promql-mcp/pkg/certs"
+	"github.com/saswatamcode/promql-mcp/pkg/guard"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
+	"github.com/saswatamcode/promql-mcp/pkg/search"
+	"github.com/saswatamcode/promql-mcp/pkg/tracing"
+	"github.com/saswatamcode/promql-mcp/pkg/transport"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the server, loaded from a YAML file.
+type Config struct {
+	Datasources []backend.Config `yaml:"datasources"`
+	// Transports are the transports to serve, unless given on the command
+	// line.
+	Transports []transport.Config `yaml:"transports"`
+	// Auth configures how callers of the HTTP transport are authenticated, and
+	// what they may use.
+	Auth auth.Config `yaml:"auth"`
+	// TLS configures TLS termination of the HTTP transport.
+	TLS certs.Config `yaml:"tls"`
+	// Audit configures the audit log of tool calls, prompt requests and
+	// resource reads.
+	Audit audit.Config `yaml:"audit"`
+	// Tracing configures where the traces of MCP requests and of the requests
+	// made against datasources are exported to.
+	Tracing tracing.Config `yaml:"tracing"`
+	// Cache configures the cache of discovery results shared by all datasources.
+	Cache cache.Config `yaml:"cache"`
+	// Budget bounds the size of every tool response.
+	Budget budget.Config `yaml:"budget"`
+	// Pagination configures how long paginated results are kept between pages.
+	Pagination pagination.Config `yaml:"pagination"`
+	// Search configures the semantic index used to search metrics.
+	Search search.Config `yaml:"search"`
+	// QueryTemplatesDir is a directory of YAML files with query templates that
+	// extend, or override, the built-in ones.
+	QueryTemplatesDir string `yaml:"query_templates_dir"`
+	// PromptsDir is a directory of prompt templates that override, or add to,
+	// the built-in prompts.
+	PromptsDir string `yaml:"prompts_dir"`
+	// PromptVariables are made available to every prompt template, e.g. to
+	// describe house conventions such as the name of the cluster label.
+	PromptVariables map[string]string `yaml:"prompt_variables"`
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	cfg := &Config{Cache: cache.DefaultConfig, Budget: budget.DefaultConfig, Pagination: pagination.DefaultConfig, Search: search.DefaultConfig, Tracing: tracing.DefaultConfig, Audit: audit.DefaultConfig}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Default returns the configuration used when no configuration file is given,
+// with a single datasource at apiURL.
+func Default(apiURL string) *Config {
+	return &Config{
+		Datasources: []backend.Config{{
+			Name:                       "prometheus",
+			URL:                        apiURL,
+			Limits:                     guard.DefaultLimits,
+			AlertPollInterval:          backend.DefaultAlertPollInterval,
+			EnvironmentRefreshInterval: backend.DefaultEnvironmentRefreshInterval,
+		}},
+		Cache:      cache.DefaultConfig,
+		Budget:     budget.DefaultConfig,
+		Pagination: pagination.DefaultConfig,
+		Search:     search.DefaultConfig,
+		Tracing:    tracing.DefaultConfig,
+		Audit:      audit.DefaultConfig,
+	}
+}
@@ -0,0 +1,168 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+// Limits are the thresholds above which a query is considered too expensive to
+// run. A zero value disables the corresponding check.
+type Limits struct {
+	// MaxSeries is the maximum number of series all selectors of a query may
+	// match in total.
+	MaxSeries int
+	// MaxSamples is the maximum number of samples a query may touch across all
+	// of its evaluation steps.
+	MaxSamples int64
+}
+
+// SelectorCost is the estimated cost of a single selector of a query.
+type SelectorCost struct {
+	Selector promql.Selector
+	Series   int
+	// Capped is set if the selector matches more series than the limit, in
+	// which case they are only counted up to one past it.
+	Capped bool
+	// SamplesPerStep is the number of samples the selector reads for every
+	// evaluation step of the query.
+	SamplesPerStep int64
+}
+
+// Estimate is the estimated cost of running a query.
+type Estimate struct {
+	Selectors []SelectorCost
+	Steps     int64
+	Series    int
+	Samples   int64
+	// Capped is set if any selector is, so that Series and Samples are only
+	// lower bounds.
+	Capped bool
+	// Violations lists every limit the query exceeds, empty if it can be run.
+	Violations []string
+}
+
+// Estimator estimates the cost of PromQL queries by counting the series that
+// each of their selectors matches, and deriving the number of samples touched
+// from the scrape interval.
+type Estimator struct {
+	client         api.Client
+	scrapeInterval func() time.Duration
+	limits         Limits
+}
+
+// NewEstimator returns an estimator that sends requests through client. The
+// scrape interval is looked up for every estimate, as it may only be
+// discovered later.
+func NewEstimator(client api.Client, scrapeInterval func() time.Duration, limits Limits) *Estimator {
+	return &Estimator{
+		client:         client,
+		scrapeInterval: scrapeInterval,
+		limits:         limits,
+	}
+}
+
+// Estimate returns the estimated cost of evaluating expr from start to end at
+// the given step. An instant query is estimated by passing the same start and
+// end, and a zero step.
+func (e *Estimator) Estimate(ctx context.Context, expr string, start, end time.Time, step time.Duration) (*Estimate, error) {
+	selectors, err := promql.Selectors(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	est := &Estimate{Steps: 1}
+	if step > 0 && end.After(start) {
+		est.Steps = int64(end.Sub(start)/step) + 1
+	}
+
+	v1api := v1.NewAPI(e.client)
+	scrapeInterval := e.scrapeInterval()
+	counts := map[string]int{}
+	for _, s := range selectors {
+		series, ok := counts[s.Match()]
+		if !ok {
+			// Series that only existed at the beginning of the lookback window of
+			// the first step are still read, so count those too.
+			var opts []v1.Option
+			if e.limits.MaxSeries > 0 {
+				// There's no need to count series past the point where the query
+				// would be rejected anyway.
+				opts = append(opts, v1.WithLimit(uint64(e.limits.MaxSeries)+1))
+			}
+			lblSets, warnings, err := v1api.Series(ctx, []string{s.Match()}, start.Add(-s.Range), end, opts...)
+			if err != nil {
+				return nil, err
+			}
+			if len(warnings) > 0 {
+				slog.Warn("Prometheus warnings", "warnings", warnings)
+			}
+			series = len(lblSets)
+			counts[s.Match()] = series
+		}
+
+		samplesPerSeries := int64(1)
+		if s.Range > 0 && scrapeInterval > 0 {
+			samplesPerSeries = max(int64(s.Range/scrapeInterval), 1)
+		}
+
+		sc := SelectorCost{
+			Selector:       s,
+			Series:         series,
+			Capped:         e.limits.MaxSeries > 0 && series > e.limits.MaxSeries,
+			SamplesPerStep: int64(series) * samplesPerSeries,
+		}
+		est.Selectors = append(est.Selectors, sc)
+		est.Capped = est.Capped || sc.Capped
+		est.Series += sc.Series
+		est.Samples += sc.SamplesPerStep * est.Steps
+	}
+
+	switch {
+	case est.Capped:
+		est.Violations = append(est.Violations, fmt.Sprintf("matches more than the limit of %d series", e.limits.MaxSeries))
+	case e.limits.MaxSeries > 0 && est.Series > e.limits.MaxSeries:
+		est.Violations = append(est.Violations, fmt.Sprintf("matches %d series, more than the limit of %d", est.Series, e.limits.MaxSeries))
+	}
+	if e.limits.MaxSamples > 0 && est.Samples > e.limits.MaxSamples {
+		at := "an estimated"
+		if est.Capped {
+			at = "at least an estimated"
+		}
+		est.Violations = append(est.Violations, fmt.Sprintf("touches %s %d samples, more than the limit of %d", at, est.Samples, e.limits.MaxSamples))
+	}
+
+	return est, nil
+}
+
+// Check estimates the cost of a query and returns an error explaining why if it
+// exceeds any of the limits. Tools that execute queries should call this before
+// sending them upstream.
+func (e *Estimator) Check(ctx context.Context, expr string, start, end time.Time, step time.Duration) error {
+	est, err := e.Estimate(ctx, expr, start, end, step)
+	if err != nil {
+		return err
+	}
+	if len(est.Violations) > 0 {
+		return &LimitError{Violations: est.Violations}
+	}
+	return nil
+}
+
+// LimitError is returned by Check for queries that exceed the limits.
+type LimitError struct {
+	Violations []string
+}
+
+func (e *LimitError) Error() string {
+	msg := "query is too expensive to run:"
+	for _, v := range e.Violations {
+		msg += " " + v + ";"
+	}
+	return msg + " narrow down the selectors with more specific label matchers, or shorten the time range or range windows"
+}
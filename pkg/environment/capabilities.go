@@ -0,0 +1,176 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+// Support is whether a backend supports a capability.
+type Support int
+
+const (
+	// Unknown means the probe of the capability failed for reasons unrelated
+	// to the capability, e.g. a timeout.
+	Unknown Support = iota
+	Supported
+	Unsupported
+)
+
+func (s Support) String() string {
+	switch s {
+	case Supported:
+		return "supported"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return "unknown"
+	}
+}
+
+// Capability is a PromQL feature that not every Prometheus-compatible backend
+// supports, along with a tiny query probing for it.
+type Capability struct {
+	Name        string
+	Description string
+	// Functions are the functions and aggregations that need the capability.
+	Functions []string
+	probe     string
+}
+
+// Capabilities are the capabilities probed for, in the order they are
+// reported.
+var Capabilities = []Capability{
+	{
+		Name:        "native_histograms",
+		Description: "functions working on native histograms",
+		Functions:   []string{"histogram_avg", "histogram_count", "histogram_fraction", "histogram_stddev", "histogram_stdvar", "histogram_sum"},
+		probe:       `histogram_count(vector(1))`,
+	},
+	{
+		Name:        "limitk",
+		Description: "experimental aggregations returning a subset of series",
+		Functions:   []string{"limitk", "limit_ratio"},
+		probe:       `limitk(1, vector(1))`,
+	},
+	{
+		Name:        "sort_by_label",
+		Description: "experimental functions sorting series by label",
+		Functions:   []string{"sort_by_label", "sort_by_label_desc"},
+		probe:       `sort_by_label(vector(1), "job")`,
+	},
+	{
+		Name:        "mad_over_time",
+		Description: "experimental median absolute deviation over time",
+		Functions:   []string{"mad_over_time"},
+		probe:       `mad_over_time(vector(1)[1m:])`,
+	},
+	{
+		Name:        "double_exponential_smoothing",
+		Description: "experimental smoothing function, called holt_winters before Prometheus 3",
+		Functions:   []string{"double_exponential_smoothing"},
+		probe:       `double_exponential_smoothing(vector(1)[1m:], 0.5, 0.5)`,
+	},
+	{
+		Name:        "holt_winters",
+		Description: "smoothing function removed in Prometheus 3",
+		Functions:   []string{"holt_winters"},
+		probe:       `holt_winters(vector(1)[1m:], 0.5, 0.5)`,
+	},
+	{
+		Name:        "info",
+		Description: "experimental function adding labels from info metrics",
+		Functions:   []string{"info"},
+		probe:       `info(vector(1))`,
+	},
+	{
+		Name:        "at_modifier",
+		Description: "the @ modifier, evaluating selectors at a fixed time",
+		probe:       `sum(up @ end())`,
+	},
+	{
+		Name:        "negative_offset",
+		Description: "negative offsets, looking ahead in time",
+		probe:       `sum(up offset -1m)`,
+	},
+	{
+		Name:        "metricsql",
+		Description: "MetricsQL extensions of VictoriaMetrics, e.g. keep_last_value",
+		Functions:   metricsQLFunctions(),
+		probe:       `keep_last_value(vector(1))`,
+	},
+}
+
+func metricsQLFunctions() []string {
+	names := make([]string, 0, len(promql.MetricsQLFunctions))
+	for _, f := range promql.MetricsQLFunctions {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// FeatureMatrix is whether a backend supports each capability, by name.
+type FeatureMatrix struct {
+	Support  map[string]Support
+	ProbedAt time.Time
+}
+
+// Probe runs the probe query of every capability against the backend.
+func Probe(ctx context.Context, api v1.API) *FeatureMatrix {
+	m := &FeatureMatrix{Support: map[string]Support{}, ProbedAt: time.Now()}
+	for _, c := range Capabilities {
+		_, _, err := api.Query(ctx, c.probe, time.Now())
+		m.Support[c.Name] = support(err)
+	}
+	return m
+}
+
+// support tells rejected queries apart from failed ones.
+func support(err error) Support {
+	if err == nil {
+		return Supported
+	}
+	var apiErr *v1.Error
+	if !errors.As(err, &apiErr) {
+		return Unknown
+	}
+	switch apiErr.Type {
+	case v1.ErrTimeout, v1.ErrCanceled, v1.ErrServer:
+		return Unknown
+	default:
+		return Unsupported
+	}
+}
+
+// Unsupported returns the functions among the given ones that the backend is
+// known not to support.
+func (m *FeatureMatrix) Unsupported(functions []string) []string {
+	var res []string
+	for _, c := range Capabilities {
+		if m.Support[c.Name] != Unsupported {
+			continue
+		}
+		for _, f := range functions {
+			if slices.Contains(c.Functions, f) {
+				res = append(res, f)
+			}
+		}
+	}
+	return res
+}
+
+// UnsupportedFunctions returns every function the backend is known not to
+// support.
+func (m *FeatureMatrix) UnsupportedFunctions() []string {
+	var res []string
+	for _, c := range Capabilities {
+		if m.Support[c.Name] == Unsupported {
+			res = append(res, c.Functions...)
+		}
+	}
+	return res
+}
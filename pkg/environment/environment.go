@@ -0,0 +1,201 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Flavours of Prometheus-compatible backends.
+const (
+	FlavourPrometheus      = "Prometheus"
+	FlavourThanos          = "Thanos"
+	FlavourMimir           = "Mimir"
+	FlavourVictoriaMetrics = "VictoriaMetrics"
+	FlavourUnknown         = "an unknown Prometheus-compatible backend"
+)
+
+// Environment describes a Prometheus-compatible backend, as far as it could be
+// discovered through its status endpoints. Zero values mean unknown.
+type Environment struct {
+	Flavour string
+	Version string
+	// ScrapeInterval is the global scrape interval, and JobScrapeIntervals are
+	// the other scrape intervals used by some jobs, in increasing order.
+	ScrapeInterval     time.Duration
+	JobScrapeIntervals []time.Duration
+	EvaluationInterval time.Duration
+	ExternalLabels     model.LabelSet
+	// Retention is how long data is kept for, e.g. 15d.
+	Retention string
+	// Features are the enabled feature flags, e.g. native-histograms.
+	Features []string
+	// Capabilities is whether the backend supports PromQL features that not
+	// every backend does, or nil if they haven't been probed.
+	Capabilities *FeatureMatrix
+
+	DiscoveredAt time.Time
+}
+
+// promConfig is the part of the Prometheus configuration that is of interest.
+type promConfig struct {
+	Global struct {
+		ScrapeInterval     model.Duration    `yaml:"scrape_interval"`
+		EvaluationInterval model.Duration    `yaml:"evaluation_interval"`
+		ExternalLabels     map[string]string `yaml:"external_labels"`
+	} `yaml:"global"`
+	ScrapeConfigs []struct {
+		ScrapeInterval model.Duration `yaml:"scrape_interval"`
+	} `yaml:"scrape_configs"`
+}
+
+// Discover works out the environment of the backend at address using its
+// buildinfo, config and flags endpoints. Backends don't all implement all of
+// them, which is also used to tell their flavour apart, so an error is only
+// returned if none of them could be queried.
+func Discover(ctx context.Context, api v1.API, address string) (*Environment, error) {
+	env := &Environment{Flavour: FlavourUnknown, DiscoveredAt: time.Now()}
+
+	build, buildErr := api.Buildinfo(ctx)
+	if buildErr == nil {
+		env.Version = build.Version
+	}
+
+	flags, flagsErr := api.Flags(ctx)
+	if flagsErr == nil {
+		if r := flags["storage.tsdb.retention.time"]; r != "" && r != "0s" {
+			env.Retention = r
+		}
+		for _, f := range strings.Split(flags["enable-feature"], ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				env.Features = append(env.Features, f)
+			}
+		}
+	}
+
+	cfg, configErr := api.Config(ctx)
+	if configErr == nil {
+		var c promConfig
+		if err := yaml.Unmarshal([]byte(cfg.YAML), &c); err != nil {
+			return nil, fmt.Errorf("parsing configuration: %w", err)
+		}
+		env.ScrapeInterval = time.Duration(c.Global.ScrapeInterval)
+		env.EvaluationInterval = time.Duration(c.Global.EvaluationInterval)
+		for _, sc := range c.ScrapeConfigs {
+			if i := time.Duration(sc.ScrapeInterval); i > 0 && i != env.ScrapeInterval && !slices.Contains(env.JobScrapeIntervals, i) {
+				env.JobScrapeIntervals = append(env.JobScrapeIntervals, i)
+			}
+		}
+		slices.Sort(env.JobScrapeIntervals)
+		if len(c.Global.ExternalLabels) > 0 {
+			env.ExternalLabels = model.LabelSet{}
+			for k, v := range c.Global.ExternalLabels {
+				env.ExternalLabels[model.LabelName(k)] = model.LabelValue(v)
+			}
+		}
+	}
+
+	if buildErr != nil && flagsErr != nil && configErr != nil {
+		return nil, errors.Join(buildErr, flagsErr, configErr)
+	}
+
+	// These are heuristics, based on which endpoints each flavour implements
+	// and what they return.
+	switch {
+	case flagsErr == nil && hasAny(flags, "query.replica-label", "endpoint", "store"):
+		env.Flavour = FlavourThanos
+	case flagsErr == nil && hasAny(flags, "config.file", "storage.tsdb.path"):
+		env.Flavour = FlavourPrometheus
+	case buildErr == nil && build.GoVersion == "" && build.Revision == "":
+		env.Flavour = FlavourVictoriaMetrics
+	case buildErr == nil && flagsErr != nil && configErr != nil, strings.HasSuffix(strings.TrimRight(path(address), "/"), "/prometheus"):
+		env.Flavour = FlavourMimir
+	}
+	return env, nil
+}
+
+func hasAny(flags v1.FlagsResult, names ...string) bool {
+	for _, n := range names {
+		if _, ok := flags[n]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func path(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// Summary returns a concise description of the environment of the datasource,
+// meant to be given to models so that they pick suitable range windows and
+// functions.
+func (e *Environment) Summary(datasource string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The datasource %s is %s", datasource, e.Flavour)
+	if e.Version != "" {
+		sb.WriteString(" " + e.Version)
+	}
+	sb.WriteString(".")
+
+	if e.ScrapeInterval > 0 {
+		fmt.Fprintf(&sb, " Targets are scraped every %s", model.Duration(e.ScrapeInterval))
+		if len(e.JobScrapeIntervals) > 0 {
+			intervals := make([]string, 0, len(e.JobScrapeIntervals))
+			for _, i := range e.JobScrapeIntervals {
+				intervals = append(intervals, model.Duration(i).String())
+			}
+			fmt.Fprintf(&sb, ", or every %s for some jobs", strings.Join(intervals, " or "))
+		}
+		longest := slices.Max(append([]time.Duration{e.ScrapeInterval}, e.JobScrapeIntervals...))
+		fmt.Fprintf(&sb, ", so use range windows of at least %s, i.e. 4 times the scrape interval, in functions like rate and increase.", model.Duration(4*longest))
+	} else {
+		sb.WriteString(" Its scrape interval could not be discovered, so use range windows of at least 5m in functions like rate and increase, unless the samples of a series show otherwise.")
+	}
+	if e.EvaluationInterval > 0 {
+		fmt.Fprintf(&sb, " Rules are evaluated every %s.", model.Duration(e.EvaluationInterval))
+	}
+	if e.Retention != "" {
+		fmt.Fprintf(&sb, " Data is kept for %s, so don't query further back than that.", e.Retention)
+	}
+
+	switch e.Flavour {
+	case FlavourPrometheus:
+		if len(e.ExternalLabels) > 0 {
+			fmt.Fprintf(&sb, " Its external labels %s are only attached to series leaving it, e.g. through remote write or federation, so don't use them in selectors against this datasource.", e.ExternalLabels)
+		}
+		if e.Capabilities != nil {
+			break
+		}
+		if slices.Contains(e.Features, "promql-experimental-functions") {
+			sb.WriteString(" Experimental PromQL functions, e.g. limitk, sort_by_label and mad_over_time, are enabled.")
+		} else {
+			sb.WriteString(" Experimental PromQL functions, e.g. limitk, sort_by_label and mad_over_time, are disabled, so don't use them.")
+		}
+	case FlavourThanos, FlavourMimir:
+		sb.WriteString(" It holds the series of several Prometheus servers, which usually carry external labels, e.g. cluster or replica, telling them apart, so use those to select or aggregate by source.")
+	case FlavourVictoriaMetrics:
+		sb.WriteString(" It understands MetricsQL, a superset of PromQL, but stick to standard PromQL so that queries stay portable. Note that its rate and increase don't extrapolate, so results may differ slightly from Prometheus.")
+	}
+	if len(e.Features) > 0 {
+		fmt.Fprintf(&sb, " Enabled feature flags: %s.", strings.Join(e.Features, ", "))
+	}
+	if e.Capabilities != nil {
+		if unsupported := e.Capabilities.UnsupportedFunctions(); len(unsupported) > 0 {
+			fmt.Fprintf(&sb, " It doesn't support the functions %s, so don't use them.", strings.Join(unsupported, ", "))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,213 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+// DefaultLimits are the limits applied to a backend that doesn't configure its
+// own.
+var DefaultLimits = Limits{
+	MaxRange:        model.Duration(7 * 24 * time.Hour),
+	MinStep:         model.Duration(15 * time.Second),
+	MaxSeries:       5000,
+	MaxConcurrency:  4,
+	Timeout:         model.Duration(10 * time.Second),
+	MaxQuerySeries:  10000,
+	MaxQuerySamples: 50000000,
+}
+
+// Limits is the policy enforced on every request made against a backend. A zero
+// value disables the corresponding check, unless stated otherwise.
+type Limits struct {
+	// AllowMatchAll allows selectors that match every series, like
+	// {__name__=~".*"}, which are rejected by default.
+	AllowMatchAll bool `yaml:"allow_match_all,omitempty"`
+	// RejectedPatterns are regular expressions that reject any selector whose
+	// match[] form, e.g. {__name__="up", job="api"}, they match.
+	RejectedPatterns []string `yaml:"rejected_patterns,omitempty"`
+	// MaxRange is the longest time range any request may cover.
+	MaxRange model.Duration `yaml:"max_range,omitempty"`
+	// MinStep is the smallest step a range query may use.
+	MinStep model.Duration `yaml:"min_step,omitempty"`
+	// MaxSeries is the maximum number of series a discovery request may return.
+	MaxSeries int `yaml:"max_series,omitempty"`
+	// MaxConcurrency is the maximum number of requests in flight to the backend
+	// at any time.
+	MaxConcurrency int `yaml:"max_concurrency,omitempty"`
+	// Timeout is how long any single request to the backend may take, and how
+	// long a request waits for one of the MaxConcurrency slots to free up.
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+
+	// ScrapeInterval is the scrape interval of the backend, used to estimate
+	// the number of samples a query touches. If it is zero, the interval
+	// discovered from the backend is used.
+	ScrapeInterval model.Duration `yaml:"scrape_interval,omitempty"`
+	// MaxQuerySeries is the maximum number of series the selectors of a query
+	// may match in total.
+	MaxQuerySeries int `yaml:"max_query_series,omitempty"`
+	// MaxQuerySamples is the maximum number of samples a query may touch.
+	MaxQuerySamples int64 `yaml:"max_query_samples,omitempty"`
+}
+
+func (l *Limits) UnmarshalYAML(unmarshal func(any) error) error {
+	*l = DefaultLimits
+	type plain Limits
+	return unmarshal((*plain)(l))
+}
+
+// Guard enforces Limits on the requests made against a single backend.
+type Guard struct {
+	limits   Limits
+	rejected []*regexp.Regexp
+	sem      chan struct{}
+}
+
+func New(limits Limits) (*Guard, error) {
+	g := &Guard{limits: limits}
+	for _, p := range limits.RejectedPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rejected pattern %q: %w", p, err)
+		}
+		g.rejected = append(g.rejected, re)
+	}
+	if limits.MaxConcurrency > 0 {
+		g.sem = make(chan struct{}, limits.MaxConcurrency)
+	}
+	return g, nil
+}
+
+func (g *Guard) Limits() Limits {
+	return g.limits
+}
+
+// CheckMatch checks a series selector, as sent in a match[] arg, against the
+// limits.
+func (g *Guard) CheckMatch(match string) error {
+	selectors, err := promql.Selectors(match)
+	if err != nil {
+		return err
+	}
+	return g.CheckSelectors(selectors)
+}
+
+// CheckSelectors checks every selector against the limits.
+func (g *Guard) CheckSelectors(selectors []promql.Selector) error {
+	for _, s := range selectors {
+		if !g.limits.AllowMatchAll && matchesAll(s) {
+			return fmt.Errorf("selector %s matches every series, which is not allowed; add a metric name or an equality label matcher like {job=\"...\"} to narrow it down", s)
+		}
+		for _, re := range g.rejected {
+			if re.MatchString(s.Match()) {
+				return fmt.Errorf("selector %s is rejected by the pattern %q configured for this datasource; rewrite it with more specific matchers", s, re.String())
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRange checks the time range of a request against the limits.
+func (g *Guard) CheckRange(start, end time.Time) error {
+	if g.limits.MaxRange > 0 && end.Sub(start) > time.Duration(g.limits.MaxRange) {
+		return fmt.Errorf("time range of %s is longer than the limit of %s; use a shorter time range", model.Duration(end.Sub(start)), g.limits.MaxRange)
+	}
+	return nil
+}
+
+// CheckStep checks the step of a range query against the limits.
+func (g *Guard) CheckStep(step time.Duration) error {
+	if g.limits.MinStep > 0 && step < time.Duration(g.limits.MinStep) {
+		return fmt.Errorf("step of %s is shorter than the limit of %s; use a larger step", model.Duration(step), g.limits.MinStep)
+	}
+	return nil
+}
+
+// CheckSeries checks the number of series returned by a request against the
+// limits.
+func (g *Guard) CheckSeries(n int) error {
+	if g.limits.MaxSeries > 0 && n > g.limits.MaxSeries {
+		return fmt.Errorf("request matched more than the limit of %d series; narrow it down with more specific label matchers, e.g. on job, namespace or a full metric name", g.limits.MaxSeries)
+	}
+	return nil
+}
+
+// SeriesLimit is the limit to ask the backend to apply to discovery requests,
+// so that exceeding CheckSeries can be detected without fetching every series.
+// It is zero if the number of series isn't limited.
+func (g *Guard) SeriesLimit() uint64 {
+	if g.limits.MaxSeries <= 0 {
+		return 0
+	}
+	return uint64(g.limits.MaxSeries) + 1
+}
+
+// Client wraps client so that every request made through it obeys the
+// concurrency and timeout limits.
+func (g *Guard) Client(client api.Client) api.Client {
+	return &guardedClient{Client: client, g: g}
+}
+
+type guardedClient struct {
+	api.Client
+	g *Guard
+}
+
+func (c *guardedClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	if c.g.sem != nil {
+		// Requests made over stdio have no deadline, so bound the wait for a
+		// slot rather than queueing behind a saturated datasource forever.
+		wait := time.Duration(c.g.limits.Timeout)
+		if wait <= 0 {
+			wait = time.Duration(DefaultLimits.Timeout)
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case c.g.sem <- struct{}{}:
+			defer func() { <-c.g.sem }()
+		case <-timer.C:
+			return nil, nil, fmt.Errorf("too many concurrent requests to this datasource, all %d allowed were still in flight after waiting %s; try again later", c.g.limits.MaxConcurrency, model.Duration(wait))
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("waiting for one of the %d concurrent requests allowed to this datasource: %w", c.g.limits.MaxConcurrency, ctx.Err())
+		}
+	}
+
+	if c.g.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.g.limits.Timeout))
+		defer cancel()
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// probes are label values used to tell whether a matcher would match any value.
+var probes = []string{"a", "0", "up", "Some:Metric_name-9", "unlikely_value_5f3a"}
+
+// matchesAll returns whether a selector would match every series, i.e. none
+// of its matchers restrict the set of series.
+func matchesAll(s promql.Selector) bool {
+	for _, m := range s.Matchers {
+		if !matchesAnyValue(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyValue(m *labels.Matcher) bool {
+	for _, p := range probes {
+		if !m.Matches(p) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package guard
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+func TestCheckSelectors(t *testing.T) {
+	for _, tc := range []struct {
+		selector string
+		limits   Limits
+		wantErr  string
+	}{
+		{selector: `up`},
+		{selector: `{job="api"}`},
+		{selector: `{__name__=~".+"}`, wantErr: "matches every series"},
+		{selector: `{job=~".+"}`, wantErr: "matches every series"},
+		{selector: `{job!=""}`, wantErr: "matches every series"},
+		{selector: `{__name__=~".+"}`, limits: Limits{AllowMatchAll: true}},
+		{selector: `{__name__=~"http_.*"}`, limits: Limits{RejectedPatterns: []string{`__name__=~`}}, wantErr: "rejected by the pattern"},
+		{selector: `http_requests_total{job="api"}`, limits: Limits{RejectedPatterns: []string{`__name__=~`}}},
+	} {
+		t.Run(tc.selector, func(t *testing.T) {
+			g, err := New(tc.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			selectors, err := promql.Selectors(tc.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = g.CheckSelectors(selectors)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	g, err := New(Limits{MaxRange: model.Duration(time.Hour), MinStep: model.Duration(time.Minute), MaxSeries: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now()
+	if err := g.CheckRange(end.Add(-time.Hour), end); err != nil {
+		t.Errorf("range of the limit rejected: %v", err)
+	}
+	if err := g.CheckRange(end.Add(-2*time.Hour), end); err == nil {
+		t.Error("range over the limit allowed")
+	}
+	if err := g.CheckStep(30 * time.Second); err == nil {
+		t.Error("step under the limit allowed")
+	}
+	if err := g.CheckSeries(11); err == nil {
+		t.Error("series over the limit allowed")
+	}
+	if got := g.SeriesLimit(); got != 11 {
+		t.Errorf("expected a series limit of 11, got %d", got)
+	}
+}
+
+// blockingClient blocks every request until release is closed, regardless of
+// its context.
+type blockingClient struct {
+	api.Client
+	release chan struct{}
+}
+
+func (c *blockingClient) Do(context.Context, *http.Request) (*http.Response, []byte, error) {
+	<-c.release
+	return &http.Response{StatusCode: http.StatusOK}, nil, nil
+}
+
+func TestConcurrencyWaitIsBounded(t *testing.T) {
+	g, err := New(Limits{MaxConcurrency: 1, Timeout: model.Duration(50 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &blockingClient{release: make(chan struct{})}
+	client := g.Client(inner)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+
+	// Hold the only slot without a deadline on the caller side.
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		_, _, _ = client.Do(context.Background(), req)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	_, _, err = client.Do(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "too many concurrent requests") {
+		t.Fatalf("expected a too many concurrent requests error, got %v", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("waited %s for a slot", waited)
+	}
+	close(inner.release)
+	<-held
+}
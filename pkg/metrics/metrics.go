@@ -0,0 +1,251 @@
+// Package metrics instruments the MCP server itself, its tool and prompt calls,
+// sessions and the requests it makes against backends, to be scraped by
+// Prometheus.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+)
+
+// Path is the path metrics are served on.
+const Path = "/metrics"
+
+const namespace = "promql_mcp"
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+// Metrics holds the metrics of the server. It implements backend.Observer to
+// instrument requests against backends.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	toolCalls        *prometheus.CounterVec
+	toolDuration     *prometheus.HistogramVec
+	toolBytes        *prometheus.HistogramVec
+	toolTokens       *prometheus.HistogramVec
+	promptCalls      *prometheus.CounterVec
+	promptDuration   *prometheus.HistogramVec
+	activeSessions   prometheus.Gauge
+	upstreamDuration *prometheus.HistogramVec
+	cacheLookups     *prometheus.CounterVec
+}
+
+// New returns the metrics of the server, registered along with the Go runtime
+// and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tool_calls_total",
+			Help:      "Total number of tool calls, by tool and whether they succeeded.",
+		}, []string{"tool", "result"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_call_duration_seconds",
+			Help:      "Duration of tool calls, by tool.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"tool"}),
+		toolBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_response_size_bytes",
+			Help:      "Size of the text of tool responses, by tool.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}, []string{"tool"}),
+		toolTokens: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_response_tokens",
+			Help:      "Estimated number of tokens of the text of tool responses, by tool.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+		}, []string{"tool"}),
+		promptCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prompt_requests_total",
+			Help:      "Total number of prompt requests, by prompt and whether they succeeded.",
+		}, []string{"prompt", "result"}),
+		promptDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prompt_request_duration_seconds",
+			Help:      "Duration of prompt requests, by prompt.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"prompt"}),
+		activeSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of MCP sessions currently open.",
+		}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Duration of requests against datasources, by datasource, API endpoint and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"datasource", "endpoint", "code"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Total number of cache lookups of discovery requests, by datasource, kind of request and whether they hit the cache.",
+		}, []string{"datasource", "kind", "result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.toolCalls,
+		m.toolDuration,
+		m.toolBytes,
+		m.toolTokens,
+		m.promptCalls,
+		m.promptDuration,
+		m.activeSessions,
+		m.upstreamDuration,
+		m.cacheLookups,
+	)
+	return m
+}
+
+// Handler returns the handler serving the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Register adds the hooks that count sessions to hooks, which must be passed
+// to the MCP server.
+func (m *Metrics) Register(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(context.Context, server.ClientSession) {
+		m.activeSessions.Inc()
+	})
+	hooks.AddOnUnregisterSession(func(context.Context, server.ClientSession) {
+		m.activeSessions.Dec()
+	})
+}
+
+// ToolMiddleware returns a tool handler middleware counting and timing tool
+// calls, and measuring their responses. It must wrap every middleware that
+// changes responses, like the budget one, to measure them as they are sent.
+func (m *Metrics) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			tool := request.Params.Name
+			start := time.Now()
+			res, err := next(ctx, request)
+			m.toolDuration.WithLabelValues(tool).Observe(time.Since(start).Seconds())
+
+			result := resultSuccess
+			if err != nil || res == nil || res.IsError {
+				result = resultError
+			}
+			m.toolCalls.WithLabelValues(tool, result).Inc()
+			if res != nil {
+				bytes, tokens := 0, 0
+				for _, c := range res.Content {
+					if t, ok := c.(mcp.TextContent); ok {
+						bytes += len(t.Text)
+						tokens += budget.EstimateTokens(t.Text)
+					}
+				}
+				m.toolBytes.WithLabelValues(tool).Observe(float64(bytes))
+				m.toolTokens.WithLabelValues(tool).Observe(float64(tokens))
+			}
+			return res, err
+		}
+	}
+}
+
+// PromptMiddleware returns a prompt handler middleware counting and timing
+// prompt requests.
+func (m *Metrics) PromptMiddleware() server.PromptHandlerMiddleware {
+	return func(next server.PromptHandlerFunc) server.PromptHandlerFunc {
+		return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			prompt := request.Params.Name
+			start := time.Now()
+			res, err := next(ctx, request)
+			m.promptDuration.WithLabelValues(prompt).Observe(time.Since(start).Seconds())
+
+			result := resultSuccess
+			if err != nil {
+				result = resultError
+			}
+			m.promptCalls.WithLabelValues(prompt, result).Inc()
+			return res, err
+		}
+	}
+}
+
+// RoundTripper implements backend.Observer, timing requests against the
+// backend named datasource by endpoint and status code.
+func (m *Metrics) RoundTripper(datasource string, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		m.upstreamDuration.WithLabelValues(datasource, endpoint(req.URL.Path), code).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+// ObserveCache implements backend.Observer, counting cache hits and misses.
+func (m *Metrics) ObserveCache(_ context.Context, datasource, kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(datasource, kind, result).Inc()
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// endpoints are the API endpoints requested by backends, which are the only
+// ones used as the endpoint label, besides the label values one.
+var endpoints = []string{
+	"/api/v1/alerts",
+	"/api/v1/labels",
+	"/api/v1/metadata",
+	"/api/v1/query",
+	"/api/v1/query_range",
+	"/api/v1/rules",
+	"/api/v1/series",
+	"/api/v1/status/buildinfo",
+	"/api/v1/status/config",
+	"/api/v1/status/flags",
+	"/api/v1/targets",
+}
+
+// endpoint returns the API endpoint of the request path p, without the path
+// prefix of the backend and with label names replaced by a placeholder, or
+// other for any endpoint backends don't request, to keep the cardinality of
+// the endpoint label bounded.
+func endpoint(p string) string {
+	i := strings.Index(p, "/api/v1/")
+	if i < 0 {
+		return "other"
+	}
+	p = p[i:]
+	if rest, ok := strings.CutPrefix(p, "/api/v1/label/"); ok && strings.HasSuffix(rest, "/values") && !strings.Contains(strings.TrimSuffix(rest, "/values"), "/") {
+		return "/api/v1/label/:name/values"
+	}
+	if !slices.Contains(endpoints, p) {
+		return "other"
+	}
+	return p
+}
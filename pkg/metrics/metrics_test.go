@@ -0,0 +1,37 @@
+package metrics
+
+import "testing"
+
+func TestEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{path: "/api/v1/query", want: "/api/v1/query"},
+		{path: "/api/v1/query_range", want: "/api/v1/query_range"},
+		{path: "/api/v1/series", want: "/api/v1/series"},
+		{path: "/api/v1/labels", want: "/api/v1/labels"},
+		{path: "/api/v1/label/job/values", want: "/api/v1/label/:name/values"},
+		{path: "/api/v1/label/__name__/values", want: "/api/v1/label/:name/values"},
+		{path: "/api/v1/metadata", want: "/api/v1/metadata"},
+		{path: "/api/v1/targets", want: "/api/v1/targets"},
+		{path: "/api/v1/rules", want: "/api/v1/rules"},
+		{path: "/api/v1/alerts", want: "/api/v1/alerts"},
+		{path: "/api/v1/status/buildinfo", want: "/api/v1/status/buildinfo"},
+		{path: "/api/v1/status/config", want: "/api/v1/status/config"},
+		{path: "/api/v1/status/flags", want: "/api/v1/status/flags"},
+		// Path prefixes of Thanos, Mimir or reverse proxies are dropped.
+		{path: "/thanos/api/v1/query", want: "/api/v1/query"},
+		{path: "/prometheus/api/v1/label/pod/values", want: "/api/v1/label/:name/values"},
+		// Anything else is bounded.
+		{path: "/api/v1/status/tsdb", want: "other"},
+		{path: "/api/v1/label/a/b/values", want: "other"},
+		{path: "/api/v1/query/extra", want: "other"},
+		{path: "/api/v1/series-abc123", want: "other"},
+		{path: "/-/healthy", want: "other"},
+		{path: "/", want: "other"},
+	} {
+		if got := endpoint(tc.path); got != tc.want {
+			t.Errorf("endpoint(%q) = %q, expected %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package pagination
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+)
+
+// DefaultConfig is the pagination configuration used if none is configured.
+var DefaultConfig = Config{
+	SnapshotTTL:  model.Duration(5 * time.Minute),
+	MaxSnapshots: 100,
+}
+
+// Config configures how long the results being paged through are kept.
+type Config struct {
+	// SnapshotTTL is how long a result is kept after it was first fetched, for
+	// its later pages to be consistent with the first one.
+	SnapshotTTL model.Duration `yaml:"snapshot_ttl"`
+	// MaxSnapshots is how many results are kept at most, the oldest are
+	// dropped first.
+	MaxSnapshots int `yaml:"max_snapshots"`
+}
+
+// reserve is the room left in the budget of a page for the text around its
+// items.
+var reserve = budget.Budget{MaxTokens: 150, MaxBytes: 600}
+
+// ErrExpired is returned for cursors of snapshots that are no longer kept.
+var ErrExpired = errors.New("the cursor has expired, repeat the request without a cursor to start over")
+
+// Page is a page of the items of a result.
+type Page struct {
+	// What describes the items, e.g. series.
+	What  string
+	Items []string
+	// Offset is the index of the first item of the page within the result.
+	Offset int
+	Total  int
+	// Next is the cursor of the next page, or empty if this is the last one.
+	Next string
+}
+
+type snapshot struct {
+	id      string
+	scope   string
+	what    string
+	items   []string
+	expires time.Time
+}
+
+// Store keeps snapshots of results, so that they can be paged through with
+// opaque cursors and stay consistent from one page to the next.
+type Store struct {
+	ttl time.Duration
+	max int
+
+	mu        sync.Mutex
+	snapshots []*snapshot
+}
+
+func NewStore(cfg Config) *Store {
+	return &Store{ttl: time.Duration(cfg.SnapshotTTL), max: cfg.MaxSnapshots}
+}
+
+// First returns the first page of items, described by what. If they don't all
+// fit in a page, they are snapshotted for their next pages to be fetched with
+// the cursor of the page. Cursors are only valid within scope, which identifies
+// the tool, the datasource and the tenant the items were fetched for.
+func (s *Store) First(scope, what string, items []string, size int, b budget.Budget) Page {
+	p := page(what, items, 0, size, b)
+	if p.Offset+len(p.Items) < len(items) {
+		p.Next = cursor(s.save(scope, what, items), len(p.Items))
+	}
+	return p
+}
+
+// Snapshot snapshots items, described by what, and returns the cursor of their
+// first page.
+func (s *Store) Snapshot(scope, what string, items []string) string {
+	return cursor(s.save(scope, what, items), 0)
+}
+
+// Next returns the page of a snapshot within scope at cursor.
+func (s *Store) Next(scope, c string, size int, b budget.Budget) (Page, error) {
+	id, offset, err := parseCursor(c)
+	if err != nil {
+		return Page{}, err
+	}
+	snap, err := s.get(id)
+	if err != nil {
+		return Page{}, err
+	}
+	if snap.scope != scope {
+		return Page{}, errors.New("the cursor was not returned by this tool for this datasource and tenant")
+	}
+	if offset > len(snap.items) {
+		return Page{}, errors.New("invalid cursor")
+	}
+
+	p := page(snap.what, snap.items, offset, size, b)
+	if p.Offset+len(p.Items) < len(snap.items) {
+		p.Next = cursor(id, p.Offset+len(p.Items))
+	}
+	return p, nil
+}
+
+// page returns up to size items starting at offset, or as many as fit in the
+// budget, but always at least one.
+func page(what string, items []string, offset, size int, b budget.Budget) Page {
+	p := Page{What: what, Offset: offset, Total: len(items)}
+	tokens, bytes := 0, 0
+	for _, item := range items[offset:] {
+		if size > 0 && len(p.Items) == size {
+			break
+		}
+		tokens += budget.EstimateTokens(item) + 1
+		bytes += len(item) + 1
+		if len(p.Items) > 0 && ((b.MaxTokens > 0 && tokens > b.MaxTokens-reserve.MaxTokens) || (b.MaxBytes > 0 && bytes > b.MaxBytes-reserve.MaxBytes)) {
+			break
+		}
+		p.Items = append(p.Items, item)
+	}
+	return p
+}
+
+func (s *Store) save(scope, what string, items []string) string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	snap := &snapshot{id: hex.EncodeToString(id), scope: scope, what: what, items: items, expires: time.Now().Add(s.ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	if s.max > 0 && len(s.snapshots) >= s.max {
+		s.snapshots = s.snapshots[len(s.snapshots)-s.max+1:]
+	}
+	s.snapshots = append(s.snapshots, snap)
+	return snap.id
+}
+
+func (s *Store) get(id string) (*snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	for _, snap := range s.snapshots {
+		if snap.id == id {
+			return snap, nil
+		}
+	}
+	return nil, ErrExpired
+}
+
+// expire drops the snapshots past their TTL, which are the oldest ones.
+func (s *Store) expire() {
+	now := time.Now()
+	i := 0
+	for i < len(s.snapshots) && now.After(s.snapshots[i].expires) {
+		i++
+	}
+	s.snapshots = s.snapshots[i:]
+}
+
+func cursor(id string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id + ":" + strconv.Itoa(offset)))
+}
+
+func parseCursor(c string) (string, int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	id, o, ok := strings.Cut(string(b), ":")
+	offset, err := strconv.Atoi(o)
+	if !ok || err != nil || offset < 0 {
+		return "", 0, errors.New("invalid cursor")
+	}
+	return id, offset, nil
+}
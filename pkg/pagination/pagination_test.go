@@ -0,0 +1,131 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+)
+
+func items(n int) []string {
+	res := make([]string, 0, n)
+	for i := range n {
+		res = append(res, fmt.Sprintf("item%03d", i))
+	}
+	return res
+}
+
+func TestPages(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		items     int
+		size      int
+		budget    budget.Budget
+		wantPages []int
+	}{
+		{name: "single page", items: 5, size: 10, wantPages: []int{5}},
+		{name: "by size", items: 25, size: 10, wantPages: []int{10, 10, 5}},
+		{name: "by budget", items: 10, budget: budget.Budget{MaxBytes: reserve.MaxBytes + 32}, wantPages: []int{4, 4, 2}},
+		{name: "at least one item", items: 2, budget: budget.Budget{MaxTokens: 1}, wantPages: []int{1, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStore(DefaultConfig)
+			all := items(tc.items)
+
+			var got []int
+			var seen []string
+			p := s.First("scope", "items", all, tc.size, tc.budget)
+			for {
+				if p.What != "items" {
+					t.Fatalf("page %d describes its items as %q, expected items", len(got), p.What)
+				}
+				if p.Total != tc.items || p.Offset != len(seen) {
+					t.Fatalf("page %d has offset %d of %d, expected %d of %d", len(got), p.Offset, p.Total, len(seen), tc.items)
+				}
+				got = append(got, len(p.Items))
+				seen = append(seen, p.Items...)
+				if p.Next == "" {
+					break
+				}
+				var err error
+				p, err = s.Next("scope", p.Next, tc.size, tc.budget)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !slices.Equal(got, tc.wantPages) {
+				t.Errorf("got pages of %v items, expected %v", got, tc.wantPages)
+			}
+			if !slices.Equal(seen, all) {
+				t.Errorf("pages don't add up to the items")
+			}
+		})
+	}
+}
+
+func TestNextErrors(t *testing.T) {
+	s := NewStore(Config{SnapshotTTL: model.Duration(time.Minute), MaxSnapshots: 2})
+	c := s.Snapshot("scope", "items", items(3))
+
+	for _, tc := range []struct {
+		name    string
+		scope   string
+		cursor  string
+		wantErr string
+	}{
+		{name: "valid", scope: "scope", cursor: c},
+		{name: "not base64", scope: "scope", cursor: "!!!", wantErr: "invalid cursor"},
+		{name: "no offset", scope: "scope", cursor: "aWQ", wantErr: "invalid cursor"},
+		{name: "negative offset", scope: "scope", cursor: cursor("id", -1), wantErr: "invalid cursor"},
+		{name: "offset past the end", scope: "scope", cursor: cursor(mustID(t, c), 4), wantErr: "invalid cursor"},
+		{name: "unknown snapshot", scope: "scope", cursor: cursor("unknown", 0), wantErr: ErrExpired.Error()},
+		{name: "other scope", scope: "other", cursor: c, wantErr: "not returned by this tool"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.Next(tc.scope, tc.cursor, 0, budget.Budget{})
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotsExpire(t *testing.T) {
+	s := NewStore(Config{SnapshotTTL: model.Duration(time.Millisecond)})
+	c := s.Snapshot("scope", "items", items(3))
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.Next("scope", c, 0, budget.Budget{}); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected the cursor to have expired, got %v", err)
+	}
+}
+
+func TestMaxSnapshots(t *testing.T) {
+	s := NewStore(Config{SnapshotTTL: model.Duration(time.Minute), MaxSnapshots: 2})
+	first := s.Snapshot("scope", "items", items(1))
+	s.Snapshot("scope", "items", items(1))
+	last := s.Snapshot("scope", "items", items(1))
+
+	if _, err := s.Next("scope", first, 0, budget.Budget{}); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected the oldest snapshot to be dropped, got %v", err)
+	}
+	if _, err := s.Next("scope", last, 0, budget.Budget{}); err != nil {
+		t.Errorf("expected the newest snapshot to be kept, got %v", err)
+	}
+}
+
+func mustID(t *testing.T, c string) string {
+	t.Helper()
+	id, _, err := parseCursor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
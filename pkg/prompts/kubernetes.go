@@ -0,0 +1,246 @@
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+const (
+	// workloadWindow is how far back to look for the pods and metrics of a
+	// workload.
+	workloadWindow = time.Hour
+)
+
+// workloadKinds maps the kinds of workloads to the regular expression matching
+// the names of their pods, given the name of the workload, and to the label that
+// kube-state-metrics puts the name of the workload in.
+var workloadKinds = map[string]struct {
+	podRegex string
+	label    string
+}{
+	"deployment":  {podRegex: `%s-[a-z0-9]+-[a-z0-9]+`, label: "deployment"},
+	"statefulset": {podRegex: `%s-[0-9]+`, label: "statefulset"},
+	"daemonset":   {podRegex: `%s-[a-z0-9]+`, label: "daemonset"},
+	"job":         {podRegex: `%s-[a-z0-9]+`, label: "job_name"},
+	"pod":         {podRegex: `%s`, label: "pod"},
+}
+
+// Namespaces are named by DNS-1123 labels, and workloads and pods by DNS-1123
+// subdomains, neither of which can hold characters that would need escaping
+// in the queries they are put in.
+var (
+	dns1123Label     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dns1123Subdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// WorkloadKinds returns the kinds of workloads supported by the
+// kubernetes_workload_health prompt.
+func WorkloadKinds() []string {
+	kinds := make([]string, 0, len(workloadKinds))
+	for k := range workloadKinds {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// WorkloadLabel returns the label that kube-state-metrics puts the name of
+// workloads of the given kind in.
+func WorkloadLabel(kind string) (string, bool) {
+	k, ok := workloadKinds[kind]
+	return k.label, ok
+}
+
+// workloadQuery is a vetted query template used to assess the health of a
+// Kubernetes workload. $namespace, $pod and $workload are replaced with the
+// namespace, the regular expression matching the pods and the name of the
+// workload respectively.
+type workloadQuery struct {
+	name        string
+	description string
+	// kinds restricts the query to workloads of these kinds, if set.
+	kinds []string
+	// metrics must all exist in the namespace for the query to be offered.
+	metrics []string
+	query   string
+}
+
+var workloadQueries = []workloadQuery{
+	{
+		name:        "Replicas",
+		description: "The ratio of available to desired replicas, below 1 means the workload is degraded.",
+		kinds:       []string{"deployment"},
+		metrics:     []string{"kube_deployment_status_replicas_available", "kube_deployment_spec_replicas"},
+		query:       `kube_deployment_status_replicas_available{namespace="$namespace", deployment="$workload"} / kube_deployment_spec_replicas{namespace="$namespace", deployment="$workload"}`,
+	},
+	{
+		name:        "Replicas",
+		description: "The ratio of ready to desired replicas, below 1 means the workload is degraded.",
+		kinds:       []string{"statefulset"},
+		metrics:     []string{"kube_statefulset_status_replicas_ready", "kube_statefulset_replicas"},
+		query:       `kube_statefulset_status_replicas_ready{namespace="$namespace", statefulset="$workload"} / kube_statefulset_replicas{namespace="$namespace", statefulset="$workload"}`,
+	},
+	{
+		name:        "Replicas",
+		description: "The ratio of ready to desired pods, below 1 means the workload is degraded.",
+		kinds:       []string{"daemonset"},
+		metrics:     []string{"kube_daemonset_status_number_ready", "kube_daemonset_status_desired_number_scheduled"},
+		query:       `kube_daemonset_status_number_ready{namespace="$namespace", daemonset="$workload"} / kube_daemonset_status_desired_number_scheduled{namespace="$namespace", daemonset="$workload"}`,
+	},
+	{
+		name:        "Failed jobs",
+		description: "The number of failed pods of the job, anything above 0 needs looking into.",
+		kinds:       []string{"job"},
+		metrics:     []string{"kube_job_status_failed"},
+		query:       `kube_job_status_failed{namespace="$namespace", job_name="$workload"}`,
+	},
+	{
+		name:        "Restarts",
+		description: "Container restarts over the last hour, anything above 0 means containers are crashing or being killed.",
+		metrics:     []string{"kube_pod_container_status_restarts_total"},
+		query:       `sum by (pod, container) (increase(kube_pod_container_status_restarts_total{namespace="$namespace", pod=~"$pod"}[1h]))`,
+	},
+	{
+		name:        "OOMKills",
+		description: "Containers whose last termination was due to running out of memory.",
+		metrics:     []string{"kube_pod_container_status_last_terminated_reason"},
+		query:       `sum by (pod, container) (kube_pod_container_status_last_terminated_reason{namespace="$namespace", pod=~"$pod", reason="OOMKilled"})`,
+	},
+	{
+		name:        "Waiting containers",
+		description: "Containers that are waiting to start and why, e.g. CrashLoopBackOff or ImagePullBackOff.",
+		metrics:     []string{"kube_pod_container_status_waiting_reason"},
+		query:       `sum by (pod, container, reason) (kube_pod_container_status_waiting_reason{namespace="$namespace", pod=~"$pod"}) > 0`,
+	},
+	{
+		name:        "Pending pods",
+		description: "Pods that can't be scheduled or started, anything above 0 means a lack of capacity or a misconfiguration.",
+		metrics:     []string{"kube_pod_status_phase"},
+		query:       `sum by (pod) (kube_pod_status_phase{namespace="$namespace", pod=~"$pod", phase="Pending"}) > 0`,
+	},
+	{
+		name:        "Readiness",
+		description: "Pods that are not ready, and so not receiving traffic.",
+		metrics:     []string{"kube_pod_status_ready"},
+		query:       `sum by (pod) (kube_pod_status_ready{namespace="$namespace", pod=~"$pod", condition="false"}) > 0`,
+	},
+	{
+		name:        "CPU throttling",
+		description: "The ratio of CPU periods in which containers were throttled, above 0.25 hurts latency and means the CPU limit is too low.",
+		metrics:     []string{"container_cpu_cfs_throttled_periods_total", "container_cpu_cfs_periods_total"},
+		query:       `sum by (pod, container) (increase(container_cpu_cfs_throttled_periods_total{namespace="$namespace", pod=~"$pod", container!=""}[5m])) / sum by (pod, container) (increase(container_cpu_cfs_periods_total{namespace="$namespace", pod=~"$pod", container!=""}[5m]))`,
+	},
+	{
+		name:        "CPU usage vs requests",
+		description: "The ratio of CPU used to CPU requested by containers, well above 1 means the requests are too low.",
+		metrics:     []string{"container_cpu_usage_seconds_total", "kube_pod_container_resource_requests"},
+		query:       `sum by (pod, container) (rate(container_cpu_usage_seconds_total{namespace="$namespace", pod=~"$pod", container!=""}[5m])) / sum by (pod, container) (kube_pod_container_resource_requests{namespace="$namespace", pod=~"$pod", resource="cpu"})`,
+	},
+	{
+		name:        "Memory usage vs limits",
+		description: "The ratio of the working set memory of containers to their memory limit, close to 1 means they are about to be OOMKilled.",
+		metrics:     []string{"container_memory_working_set_bytes", "kube_pod_container_resource_limits"},
+		query:       `sum by (pod, container) (container_memory_working_set_bytes{namespace="$namespace", pod=~"$pod", container!=""}) / sum by (pod, container) (kube_pod_container_resource_limits{namespace="$namespace", pod=~"$pod", resource="memory"})`,
+	},
+}
+
+// workloadHealth is the data the kubernetes_workload_health prompt is rendered
+// with.
+type workloadHealth struct {
+	Data
+	Kind, Name, Namespace string
+	// Pods are the pods of the workload seen over the last hour, and MorePods
+	// is set if there were more than the series limit of them.
+	Pods     []string
+	MorePods bool
+	// Checks are the vetted queries whose metrics exist for the workload.
+	Checks []workloadCheck
+	// Missing are the names of the checks whose metrics don't exist.
+	Missing []string
+}
+
+type workloadCheck struct {
+	Name, Description, Query string
+}
+
+func kubernetesWorkloadHealthData(ctx context.Context, backends *backend.Set, data Data) (any, error) {
+	namespace := data.Args["namespace"]
+	kind := strings.ToLower(data.Args["workload_kind"])
+	wk, ok := workloadKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("workload_kind must be one of %s", strings.Join(WorkloadKinds(), ", "))
+	}
+	name := data.Args["workload_name"]
+	if len(namespace) > 63 || !dns1123Label.MatchString(namespace) {
+		return nil, fmt.Errorf("namespace %q is not a valid Kubernetes namespace name", namespace)
+	}
+	if len(name) > 253 || !dns1123Subdomain.MatchString(name) {
+		return nil, fmt.Errorf("workload_name %q is not a valid Kubernetes %s name", name, kind)
+	}
+	data, b, err := withDatasource(backends, data)
+	if err != nil {
+		return nil, err
+	}
+	res := workloadHealth{Data: data, Kind: kind, Name: name, Namespace: namespace}
+
+	end := time.Now()
+	start := end.Add(-workloadWindow)
+	podRegex := fmt.Sprintf(wk.podRegex, regexp.QuoteMeta(name))
+
+	// Find the pods of the workload, so that the model knows what it is
+	// looking at, and so that a mistyped name is caught early.
+	pods, err := b.LabelValues(ctx, "pod", []string{fmt.Sprintf("{namespace=%q, pod=~%q}", namespace, podRegex)}, start, end, b.Guard.SeriesLimit())
+	if err != nil {
+		slog.Error("error querying Prometheus", "error", err)
+		return nil, fmt.Errorf("error querying Prometheus: %w", err)
+	}
+	pods.Value, res.MorePods = b.TruncateValues(pods.Value)
+	for _, p := range pods.Value {
+		res.Pods = append(res.Pods, string(p))
+	}
+
+	// The regular expression ends up in a double quoted PromQL string, in
+	// which its backslashes need escaping.
+	replacer := strings.NewReplacer("$namespace", namespace, "$pod", strings.ReplaceAll(podRegex, `\`, `\\`), "$workload", name)
+	for _, q := range workloadQueries {
+		if len(q.kinds) > 0 && !slices.Contains(q.kinds, kind) {
+			continue
+		}
+
+		ok, err := metricsExist(ctx, b, namespace, q.metrics, start, end)
+		if err != nil {
+			slog.Error("error querying Prometheus", "error", err)
+			return nil, fmt.Errorf("error querying Prometheus: %w", err)
+		}
+		if !ok {
+			res.Missing = append(res.Missing, q.name)
+			continue
+		}
+		res.Checks = append(res.Checks, workloadCheck{Name: q.name, Description: q.description, Query: replacer.Replace(q.query)})
+	}
+	if len(res.Checks) == 0 {
+		return nil, fmt.Errorf("none of the metrics needed to assess the health of workloads exist in the namespace %s of the %s datasource; make sure kube-state-metrics and cAdvisor are scraped", namespace, b.Name)
+	}
+	return res, nil
+}
+
+// metricsExist returns whether every one of metrics has series in namespace.
+func metricsExist(ctx context.Context, b *backend.Backend, namespace string, metrics []string, start, end time.Time) (bool, error) {
+	for _, m := range metrics {
+		res, err := b.Series(ctx, []string{fmt.Sprintf("{__name__=%q, namespace=%q}", m, namespace)}, start, end, 1)
+		if err != nil {
+			return false, err
+		}
+		if len(res.Value) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
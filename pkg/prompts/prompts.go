@@ -0,0 +1,233 @@
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+const frontMatterDelimiter = "---\n"
+
+// Data is what every prompt template is rendered with. Built-in prompts extend
+// it with fields of their own.
+type Data struct {
+	// Args are the arguments the prompt was requested with.
+	Args map[string]string
+	// Datasource is the name of the datasource selected by the datasource
+	// argument, or of the first configured datasource.
+	Datasource string
+	// APIURL is the URL of that datasource.
+	APIURL string
+	// Environment is a summary of the environment of that datasource, e.g. its
+	// flavour and scrape interval, or empty if it hasn't been discovered.
+	Environment string
+	// Vars are the prompt variables from the configuration file, e.g. house
+	// conventions such as the name of the cluster label.
+	Vars map[string]string
+}
+
+// Argument is an argument of a prompt.
+type Argument struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// definition is a prompt loaded from a template file. Template files start with
+// a YAML front matter, between two --- lines, with the name, description and
+// arguments of the prompt. Files without a front matter are partials, which
+// can be included in prompts with {{template "<file name without .tmpl>" .}}.
+type definition struct {
+	Name        string     `yaml:"name"`
+	Description string     `yaml:"description"`
+	Arguments   []Argument `yaml:"arguments"`
+}
+
+// dataFunc computes the data a prompt template is rendered with, from the
+// common data every prompt gets.
+type dataFunc func(ctx context.Context, backends *backend.Set, data Data) (any, error)
+
+// builtins are the prompts that need more data than Data to be rendered.
+var builtins = map[string]dataFunc{
+	"prometheus_generate_promql":   datasourceData,
+	"perses_generate_dashboard":    persesDashboardData,
+	"prometheus_investigate_alert": datasourceData,
+	"kubernetes_workload_health":   kubernetesWorkloadHealthData,
+}
+
+// Load returns the built-in prompts along with those defined by the template
+// files in dir, if it is not empty. Templates in dir replace built-in templates
+// of the same name, so that both prompts and partials can be overridden. vars
+// are made available to every template as .Vars.
+func Load(dir string, vars map[string]string, backends *backend.Set) ([]server.ServerPrompt, error) {
+	root := template.New("").Option("missingkey=zero").Funcs(template.FuncMap{"join": strings.Join})
+	defs := map[string]definition{}
+
+	if err := parseTemplates(root, defs, builtinTemplates, "templates"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := parseTemplates(root, defs, os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	prompts := make([]server.ServerPrompt, 0, len(defs))
+	for _, name := range names {
+		def := defs[name]
+		data, ok := builtins[name]
+		if !ok {
+			data = datasourceData
+		}
+		prompts = append(prompts, newPrompt(root.Lookup(name), def, vars, backends, data))
+	}
+	return prompts, nil
+}
+
+func parseTemplates(root *template.Template, defs map[string]definition, fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return fmt.Errorf("reading prompt template: %w", err)
+		}
+
+		name := strings.TrimSuffix(path.Base(f), ".tmpl")
+		body := string(b)
+		if rest, ok := strings.CutPrefix(body, frontMatterDelimiter); ok {
+			header, text, ok := strings.Cut(rest, "\n"+frontMatterDelimiter)
+			if !ok {
+				return fmt.Errorf("prompt template %s: front matter is not terminated by a --- line", f)
+			}
+			var def definition
+			if err := yaml.Unmarshal([]byte(header), &def); err != nil {
+				return fmt.Errorf("parsing front matter of prompt template %s: %w", f, err)
+			}
+			if def.Name == "" {
+				return fmt.Errorf("prompt template %s: name is required", f)
+			}
+			// Overrides of built-in prompts may only change the text.
+			if prev, ok := defs[def.Name]; ok {
+				if def.Description == "" {
+					def.Description = prev.Description
+				}
+				if def.Arguments == nil {
+					def.Arguments = prev.Arguments
+				}
+			}
+			defs[def.Name] = def
+			name, body = def.Name, text
+		}
+
+		if _, err := root.New(name).Parse(body); err != nil {
+			return fmt.Errorf("parsing prompt template %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+func newPrompt(tmpl *template.Template, def definition, vars map[string]string, backends *backend.Set, data dataFunc) server.ServerPrompt {
+	opts := []mcp.PromptOption{mcp.WithPromptDescription(def.Description)}
+	for _, a := range def.Arguments {
+		argOpts := []mcp.ArgumentOption{mcp.ArgumentDescription(a.Description)}
+		if a.Required {
+			argOpts = append(argOpts, mcp.RequiredArgument())
+		}
+		opts = append(opts, mcp.WithArgument(a.Name, argOpts...))
+	}
+
+	return server.ServerPrompt{
+		Prompt: mcp.NewPrompt(def.Name, opts...),
+		Handler: func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			args := request.Params.Arguments
+			if args == nil {
+				args = map[string]string{}
+			}
+			for _, a := range def.Arguments {
+				if a.Required && args[a.Name] == "" {
+					return nil, fmt.Errorf("%s is required", a.Name)
+				}
+			}
+
+			d, err := data(ctx, backends, Data{Args: args, Vars: vars})
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, d); err != nil {
+				return nil, fmt.Errorf("rendering prompt %s: %w", def.Name, err)
+			}
+
+			return mcp.NewGetPromptResult(
+				def.Description,
+				[]mcp.PromptMessage{
+					{
+						Role:    mcp.RoleUser,
+						Content: mcp.NewTextContent(buf.String()),
+					},
+				},
+			), nil
+		},
+	}
+}
+
+// datasourceData fills in the datasource selected by the datasource argument.
+func datasourceData(ctx context.Context, backends *backend.Set, data Data) (any, error) {
+	data, _, err := withDatasource(backends, data)
+	return data, err
+}
+
+func withDatasource(backends *backend.Set, data Data) (Data, *backend.Backend, error) {
+	b, err := backends.Get(data.Args["datasource"])
+	if err != nil {
+		return data, nil, err
+	}
+	data.Datasource = b.Name
+	data.APIURL = b.Client.URL("", map[string]string{}).String()
+	data.Environment = environmentSummary(b)
+	return data, b, nil
+}
+
+// persesDashboardData leaves the datasource alone, as the datasource argument
+// of the perses_generate_dashboard prompt is the name of a Perses datasource,
+// and describes the environment of the default datasource instead.
+func persesDashboardData(ctx context.Context, backends *backend.Set, data Data) (any, error) {
+	b, err := backends.Get("")
+	if err != nil {
+		return nil, err
+	}
+	data.Environment = environmentSummary(b)
+	return data, nil
+}
+
+func environmentSummary(b *backend.Backend) string {
+	env := b.Environment()
+	if env == nil {
+		return ""
+	}
+	return env.Summary(b.Name)
+}
@@ -0,0 +1,57 @@
+package promql
+
+import "sort"
+
+// Closest returns up to n candidates that are closest to target by edit
+// distance, nearest first. Candidates further away than half the length of the
+// target (rounded up, with a minimum of 3) are not considered close.
+func Closest(target string, candidates []string, n int) []string {
+	maxDistance := max((len(target)+1)/2, 3)
+
+	type scored struct {
+		value    string
+		distance int
+	}
+	var matches []scored
+	for _, c := range candidates {
+		if d := Distance(target, c); d <= maxDistance {
+			matches = append(matches, scored{value: c, distance: d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].value < matches[j].value
+	})
+
+	res := make([]string, 0, min(n, len(matches)))
+	for i := 0; i < len(matches) && i < n; i++ {
+		res = append(res, matches[i].value)
+	}
+	return res
+}
+
+// Distance returns the Levenshtein edit distance between a and b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,79 @@
+package promql
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// MetricsQLFunctions are common MetricsQL functions of VictoriaMetrics that
+// PromQL lacks, so that expressions using them parse and they can be reported
+// to backends that don't support them.
+var MetricsQLFunctions = []*parser.Function{
+	{Name: "keep_last_value", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "keep_next_value", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "interpolate", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "running_avg", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "running_max", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "running_min", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "running_sum", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "range_avg", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "range_max", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "range_min", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "range_sum", ArgTypes: []parser.ValueType{parser.ValueTypeVector}, ReturnType: parser.ValueTypeVector},
+	{Name: "median_over_time", ArgTypes: []parser.ValueType{parser.ValueTypeMatrix}, ReturnType: parser.ValueTypeVector},
+	{Name: "distinct_over_time", ArgTypes: []parser.ValueType{parser.ValueTypeMatrix}, ReturnType: parser.ValueTypeVector},
+	{Name: "increase_pure", ArgTypes: []parser.ValueType{parser.ValueTypeMatrix}, ReturnType: parser.ValueTypeVector},
+	{Name: "lifetime", ArgTypes: []parser.ValueType{parser.ValueTypeMatrix}, ReturnType: parser.ValueTypeVector},
+	{Name: "rollup", ArgTypes: []parser.ValueType{parser.ValueTypeMatrix}, ReturnType: parser.ValueTypeVector},
+	{Name: "label_set", ArgTypes: []parser.ValueType{parser.ValueTypeVector, parser.ValueTypeString, parser.ValueTypeString}, Variadic: -1, ReturnType: parser.ValueTypeVector},
+}
+
+// functions are the functions known to Parse: every PromQL function, with
+// experimental ones enabled so that they can be checked against what the
+// backend supports rather than being rejected outright, and the MetricsQL
+// functions.
+var functions = func() map[string]*parser.Function {
+	fns := make(map[string]*parser.Function, len(parser.Functions)+len(MetricsQLFunctions))
+	for name, f := range parser.Functions {
+		f := *f
+		f.Experimental = false
+		fns[name] = &f
+	}
+	for _, f := range MetricsQLFunctions {
+		fns[f.Name] = f
+	}
+	return fns
+}()
+
+// Parse parses the given expression, accepting every function known to any
+// backend. Experimental aggregations, e.g. limitk, are only accepted if
+// parser.EnableExperimentalFunctions is set.
+func Parse(expr string) (parser.Expr, error) {
+	p := parser.NewParser(expr, parser.WithFunctions(functions))
+	defer p.Close()
+	return p.ParseExpr()
+}
+
+// Functions parses the given expression and returns the names of the functions
+// and aggregations used within it, sorted and without duplicates.
+func Functions(expr string) ([]string, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+
+	var names []string
+	parser.Inspect(e, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			names = append(names, n.Func.Name)
+		case *parser.AggregateExpr:
+			names = append(names, n.Op.String())
+		}
+		return nil
+	})
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
@@ -0,0 +1,125 @@
+package promql
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Suffixes of the series of classic histograms.
+const (
+	BucketSuffix = "_bucket"
+	SumSuffix    = "_sum"
+	CountSuffix  = "_count"
+)
+
+// maxBuckets is how many bucket boundaries are listed before the middle ones
+// are elided.
+const maxBuckets = 8
+
+// Histogram is a family of series of a histogram, grouped under its base name.
+type Histogram struct {
+	Name string
+	// Buckets are the upper bounds of the buckets of a classic histogram, in
+	// increasing order. They are empty for native histograms.
+	Buckets []string
+	// Series are the distinct label sets of the histogram, without the metric
+	// name and le labels.
+	Series []model.LabelSet
+}
+
+// BucketSummary returns the bucket boundaries of the histogram, eliding the
+// middle ones if there are many of them.
+func (h Histogram) BucketSummary() string {
+	if len(h.Buckets) <= maxBuckets {
+		return strings.Join(h.Buckets, ", ")
+	}
+	head := h.Buckets[:maxBuckets/2]
+	tail := h.Buckets[len(h.Buckets)-maxBuckets/2:]
+	return strings.Join(head, ", ") + ", ..., " + strings.Join(tail, ", ")
+}
+
+// GroupClassicHistograms groups the _bucket, _sum and _count series of classic
+// histograms under their base names, and returns the other series as they are.
+func GroupClassicHistograms(series []model.LabelSet) ([]Histogram, []model.LabelSet) {
+	bases := map[string]struct{}{}
+	for _, s := range series {
+		name := string(s[model.MetricNameLabel])
+		if _, ok := s[model.BucketLabel]; ok && strings.HasSuffix(name, BucketSuffix) {
+			bases[strings.TrimSuffix(name, BucketSuffix)] = struct{}{}
+		}
+	}
+
+	byName := map[string]*Histogram{}
+	buckets := map[string]map[string]struct{}{}
+	seen := map[string]map[model.Fingerprint]struct{}{}
+	var rest []model.LabelSet
+	for _, s := range series {
+		name := string(s[model.MetricNameLabel])
+		base, ok := classicBase(name, bases)
+		if !ok {
+			rest = append(rest, s)
+			continue
+		}
+
+		h, ok := byName[base]
+		if !ok {
+			h = &Histogram{Name: base}
+			byName[base] = h
+			buckets[base] = map[string]struct{}{}
+			seen[base] = map[model.Fingerprint]struct{}{}
+		}
+		if le, ok := s[model.BucketLabel]; ok {
+			buckets[base][string(le)] = struct{}{}
+		}
+		lbls := s.Clone()
+		delete(lbls, model.MetricNameLabel)
+		delete(lbls, model.BucketLabel)
+		fp := lbls.Fingerprint()
+		if _, ok := seen[base][fp]; !ok {
+			seen[base][fp] = struct{}{}
+			h.Series = append(h.Series, lbls)
+		}
+	}
+
+	histograms := make([]Histogram, 0, len(byName))
+	for base, h := range byName {
+		for le := range buckets[base] {
+			h.Buckets = append(h.Buckets, le)
+		}
+		SortBuckets(h.Buckets)
+		histograms = append(histograms, *h)
+	}
+	slices.SortFunc(histograms, func(a, b Histogram) int { return strings.Compare(a.Name, b.Name) })
+	return histograms, rest
+}
+
+// SortBuckets sorts the upper bounds of buckets, i.e. values of the le label,
+// in increasing order.
+func SortBuckets(buckets []string) {
+	slices.SortFunc(buckets, func(a, b string) int {
+		return cmp.Compare(parseBound(a), parseBound(b))
+	})
+}
+
+func classicBase(name string, bases map[string]struct{}) (string, bool) {
+	for _, suffix := range []string{BucketSuffix, SumSuffix, CountSuffix} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			_, ok := bases[base]
+			return base, ok
+		}
+	}
+	return "", false
+}
+
+func parseBound(le string) float64 {
+	f, err := strconv.ParseFloat(le, 64)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return f
+}
@@ -0,0 +1,105 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Selector is a single vector selector found within a PromQL expression.
+type Selector struct {
+	// Name is the metric name of the selector, if it was matched by equality.
+	Name     string
+	Matchers []*labels.Matcher
+	// Range is how far back the selector reads samples for every evaluation,
+	// i.e. the range of a matrix selector plus the ranges of any subqueries it
+	// is nested in. It is zero for plain instant vector selectors.
+	Range time.Duration
+}
+
+// Match returns the selector in a form that can be sent as a match[] arg to the
+// series, labels and label values APIs, i.e. without any offset or @ modifiers.
+func (s Selector) Match() string {
+	matchers := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		matchers = append(matchers, m.String())
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+func (s Selector) String() string {
+	if s.Name == "" {
+		return s.Match()
+	}
+
+	matchers := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+			continue
+		}
+		matchers = append(matchers, m.String())
+	}
+	if len(matchers) == 0 {
+		return s.Name
+	}
+	return s.Name + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// Selectors parses the given expression and returns every vector selector
+// within it, in the order they appear. The same selector may be returned more
+// than once if it is used several times in the expression.
+func Selectors(expr string) ([]Selector, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+
+	var selectors []Selector
+	parser.Inspect(e, func(node parser.Node, path []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+
+		s := Selector{Matchers: vs.LabelMatchers}
+		for _, m := range vs.LabelMatchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+				s.Name = m.Value
+			}
+		}
+		for _, p := range path {
+			if sq, ok := p.(*parser.SubqueryExpr); ok {
+				s.Range += sq.Range
+			}
+		}
+		if len(path) > 0 {
+			if ms, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+				s.Range += ms.Range
+			}
+		}
+		selectors = append(selectors, s)
+		return nil
+	})
+
+	return selectors, nil
+}
+
+// Unique returns the selectors with any that match the same series as an
+// earlier one removed, regardless of their range.
+func Unique(selectors []Selector) []Selector {
+	var (
+		res  []Selector
+		seen = map[string]struct{}{}
+	)
+	for _, s := range selectors {
+		if _, ok := seen[s.Match()]; ok {
+			continue
+		}
+		seen[s.Match()] = struct{}{}
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package promql
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// MetricSummary summarises the series of a single metric.
+type MetricSummary struct {
+	Name   string
+	Series int
+	// Labels are the labels of the series, other than the metric name, in
+	// alphabetical order.
+	Labels []LabelSummary
+}
+
+// LabelSummary summarises the values of a label across the series of a metric.
+type LabelSummary struct {
+	Name string
+	// Values is the number of distinct values of the label.
+	Values int
+	// Top are the most common values of the label, most common first.
+	Top []ValueCount
+}
+
+// ValueCount is a label value along with the number of series that have it.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// Summarise groups series by metric name, and summarises the labels of each
+// metric by their topN most common values. Metrics are sorted by name.
+func Summarise(series []model.LabelSet, topN int) []MetricSummary {
+	type metric struct {
+		series int
+		values map[model.LabelName]map[model.LabelValue]int
+	}
+	metrics := map[string]*metric{}
+	for _, s := range series {
+		name := string(s[model.MetricNameLabel])
+		m, ok := metrics[name]
+		if !ok {
+			m = &metric{values: map[model.LabelName]map[model.LabelValue]int{}}
+			metrics[name] = m
+		}
+		m.series++
+		for l, v := range s {
+			if l == model.MetricNameLabel {
+				continue
+			}
+			if m.values[l] == nil {
+				m.values[l] = map[model.LabelValue]int{}
+			}
+			m.values[l][v]++
+		}
+	}
+
+	summaries := make([]MetricSummary, 0, len(metrics))
+	for name, m := range metrics {
+		s := MetricSummary{Name: name, Series: m.series}
+		for l, values := range m.values {
+			ls := LabelSummary{Name: string(l), Values: len(values)}
+			for v, c := range values {
+				ls.Top = append(ls.Top, ValueCount{Value: string(v), Count: c})
+			}
+			slices.SortFunc(ls.Top, func(a, b ValueCount) int {
+				if c := cmp.Compare(b.Count, a.Count); c != 0 {
+					return c
+				}
+				return strings.Compare(a.Value, b.Value)
+			})
+			if len(ls.Top) > topN {
+				ls.Top = ls.Top[:topN]
+			}
+			s.Labels = append(s.Labels, ls)
+		}
+		slices.SortFunc(s.Labels, func(a, b LabelSummary) int { return strings.Compare(a.Name, b.Name) })
+		summaries = append(summaries, s)
+	}
+	slices.SortFunc(summaries, func(a, b MetricSummary) int { return strings.Compare(a.Name, b.Name) })
+	return summaries
+}
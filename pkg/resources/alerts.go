@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+func Alerts(b *backend.Backend) (resource mcp.Resource, handler server.ResourceHandlerFunc) {
+	return mcp.NewResource(uri(b, "alerts"), b.Name+" alerts",
+			mcp.WithResourceDescription(fmt.Sprintf("The alerts currently firing in the %s datasource. Subscribe to it to be notified when alerts start or stop firing.", b.Name)),
+			mcp.WithMIMEType("text/plain"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			alerts, err := firingAlerts(ctx, b)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+
+			var sb strings.Builder
+			if len(alerts) == 0 {
+				fmt.Fprintf(&sb, "There are no alerts firing in the %s datasource.\n", b.Name)
+			} else {
+				fmt.Fprintf(&sb, "The following %d alerts are firing in the %s datasource:\n\n", len(alerts), b.Name)
+			}
+			for _, a := range alerts {
+				fmt.Fprintf(&sb, "%s since %s, value %s\n", a.Labels, a.ActiveAt.Format(time.RFC3339), a.Value)
+				names := make([]string, 0, len(a.Annotations))
+				for name := range a.Annotations {
+					names = append(names, string(name))
+				}
+				slices.Sort(names)
+				for _, name := range names {
+					fmt.Fprintf(&sb, "  %s: %s\n", name, a.Annotations[model.LabelName(name)])
+				}
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/plain",
+					Text:     sb.String(),
+				},
+			}, nil
+		}
+}
+
+func firingAlerts(ctx context.Context, b *backend.Backend) ([]v1.Alert, error) {
+	res, err := v1.NewAPI(b.Client).Alerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []v1.Alert
+	for _, a := range res.Alerts {
+		if a.State == v1.AlertStateFiring {
+			alerts = append(alerts, a)
+		}
+	}
+	slices.SortFunc(alerts, func(a, b v1.Alert) int {
+		return strings.Compare(a.Labels.String(), b.Labels.String())
+	})
+	return alerts, nil
+}
+
+// AlertWatcher polls the firing alerts of a datasource, and notifies the
+// sessions subscribed to its alerts resource whenever they change.
+type AlertWatcher struct {
+	b        *backend.Backend
+	interval time.Duration
+	srv      *server.MCPServer
+	subs     *Subscriptions
+}
+
+func NewAlertWatcher(b *backend.Backend, interval time.Duration, srv *server.MCPServer, subs *Subscriptions) *AlertWatcher {
+	return &AlertWatcher{
+		b:        b,
+		interval: interval,
+		srv:      srv,
+		subs:     subs,
+	}
+}
+
+// Run polls alerts until ctx is canceled.
+func (w *AlertWatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var last []model.Fingerprint
+	initialized := false
+	for {
+		alerts, err := firingAlerts(ctx, w.b)
+		if err != nil {
+			slog.Warn("error polling alerts", "datasource", w.b.Name, "error", err)
+		} else {
+			current := make([]model.Fingerprint, 0, len(alerts))
+			for _, a := range alerts {
+				current = append(current, a.Labels.Fingerprint())
+			}
+			slices.Sort(current)
+
+			if initialized && !slices.Equal(last, current) {
+				slog.Debug("firing alerts changed", "datasource", w.b.Name, "firing", len(current))
+				w.subs.Notify(w.srv, uri(w.b, "alerts"))
+			}
+			last, initialized = current, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
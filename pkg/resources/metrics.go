@@ -0,0 +1,288 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+// window is how far back resources look for series, label names and values.
+const window = time.Hour
+
+func uri(b *backend.Backend, path string) string {
+	return "prometheus://" + b.Name + "/" + path
+}
+
+func MetricCatalog(b *backend.Backend) (resource mcp.Resource, handler server.ResourceHandlerFunc) {
+	return mcp.NewResource(uri(b, "metrics"), b.Name+" metrics",
+			mcp.WithResourceDescription(fmt.Sprintf("The names of all metrics in the %s datasource, along with their type and help text.", b.Name)),
+			mcp.WithMIMEType("text/plain"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			end := time.Now()
+			limit := b.Guard.SeriesLimit()
+			names, err := b.LabelValues(ctx, labels.MetricName, nil, end.Add(-window), end, limit)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+			metadataLimit := ""
+			if limit > 0 {
+				metadataLimit = strconv.FormatUint(limit, 10)
+			}
+			metadata, err := b.Metadata(ctx, "", metadataLimit)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+			var truncated bool
+			names.Value, truncated = b.TruncateValues(names.Value)
+
+			exists := map[string]struct{}{}
+			for _, name := range names.Value {
+				exists[string(name)] = struct{}{}
+			}
+
+			var lines []string
+			for _, name := range names.Value {
+				// Classic histograms are listed once, under their base name.
+				if base, ok := classicHistogram(string(name), exists); ok {
+					if strings.HasSuffix(string(name), promql.BucketSuffix) {
+						lines = append(lines, formatMetadata(base, metadata.Value[base])+" - classic histogram exposed as "+base+"_bucket, _sum and _count")
+					}
+					continue
+				}
+				line := formatMetadata(string(name), metadata.Value[string(name)])
+				if isHistogram(metadata.Value[string(name)]) {
+					line += " - native histogram"
+				}
+				lines = append(lines, line)
+			}
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "The %s datasource has the following %d metrics:\n\n", b.Name, len(lines))
+			if truncated {
+				fmt.Fprintf(&sb, "It has more than the limit of %d metrics, so only some of them are listed, use prometheus_search_metrics to find others.\n\n", b.Guard.Limits().MaxSeries)
+			}
+			for _, l := range lines {
+				sb.WriteString(l + "\n")
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/plain",
+					Text:     sb.String(),
+				},
+			}, nil
+		}
+}
+
+func Metric(b *backend.Backend) (template mcp.ResourceTemplate, handler server.ResourceTemplateHandlerFunc) {
+	return mcp.NewResourceTemplate(uri(b, "metric/{name}"), b.Name+" metric",
+			mcp.WithTemplateDescription(fmt.Sprintf("The type, help text, unit and label names of a single metric in the %s datasource, and for histograms whether they are classic or native histograms and how to query them.", b.Name)),
+			mcp.WithTemplateMIMEType("text/plain"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			name, err := argument(request, "name")
+			if err != nil {
+				return nil, err
+			}
+
+			metadata, err := b.Metadata(ctx, name, "")
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+			end := time.Now()
+			lblNames, err := b.LabelNames(ctx, []string{fmt.Sprintf("{%s=%q}", labels.MetricName, name)}, end.Add(-window), end)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+			note := ""
+			if isHistogram(metadata.Value[name]) || len(lblNames.Value) == 0 {
+				note, err = histogramNote(ctx, b, name, end)
+				if err != nil {
+					slog.Error("error querying Prometheus", "error", err)
+					return nil, fmt.Errorf("error querying Prometheus: %w", err)
+				}
+			}
+			if len(lblNames.Value) == 0 && note != "" {
+				// Classic histograms have no series under their base name, so
+				// list the labels of their buckets instead.
+				lblNames, err = b.LabelNames(ctx, []string{fmt.Sprintf("{%s=%q}", labels.MetricName, name+promql.BucketSuffix)}, end.Add(-window), end)
+				if err != nil {
+					slog.Error("error querying Prometheus", "error", err)
+					return nil, fmt.Errorf("error querying Prometheus: %w", err)
+				}
+			}
+			if len(lblNames.Value) == 0 && len(metadata.Value[name]) == 0 {
+				return nil, fmt.Errorf("metric %q does not exist in the %s datasource", name, b.Name)
+			}
+
+			var sb strings.Builder
+			sb.WriteString(formatMetadata(name, metadata.Value[name]) + "\n\n")
+			sb.WriteString(note)
+			sb.WriteString("It has the following labels:\n\n")
+			for _, l := range lblNames.Value {
+				if l == labels.MetricName {
+					continue
+				}
+				sb.WriteString(l + "\n")
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/plain",
+					Text:     sb.String(),
+				},
+			}, nil
+		}
+}
+
+func LabelValues(b *backend.Backend) (template mcp.ResourceTemplate, handler server.ResourceTemplateHandlerFunc) {
+	return mcp.NewResourceTemplate(uri(b, "label/{name}/values"), b.Name+" label values",
+			mcp.WithTemplateDescription(fmt.Sprintf("All values of a single label in the %s datasource.", b.Name)),
+			mcp.WithTemplateMIMEType("text/plain"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			name, err := argument(request, "name")
+			if err != nil {
+				return nil, err
+			}
+
+			end := time.Now()
+			values, err := b.LabelValues(ctx, name, nil, end.Add(-window), end, b.Guard.SeriesLimit())
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return nil, fmt.Errorf("error querying Prometheus: %w", err)
+			}
+			var truncated bool
+			values.Value, truncated = b.TruncateValues(values.Value)
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "The label %s has the following %d values:\n\n", name, len(values.Value))
+			if truncated {
+				fmt.Fprintf(&sb, "It has more than the limit of %d values, so only some of them are listed, use prometheus_get_label_values to page through all of them.\n\n", b.Guard.Limits().MaxSeries)
+			}
+			for _, v := range values.Value {
+				sb.WriteString(string(v) + "\n")
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/plain",
+					Text:     sb.String(),
+				},
+			}, nil
+		}
+}
+
+// argument returns a variable of the resource template matched by a request.
+func argument(request mcp.ReadResourceRequest, name string) (string, error) {
+	// Variables are matched as lists, which hold a single value for the simple
+	// expansions used by our templates.
+	switch v := request.Params.Arguments[name].(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case []string:
+		if len(v) == 1 && v[0] != "" {
+			return v[0], nil
+		}
+	}
+	return "", errors.New(name + " is required")
+}
+
+// classicHistogram returns the base name of the classic histogram that the
+// series name belongs to, if its _bucket series exist.
+func classicHistogram(name string, exists map[string]struct{}) (string, bool) {
+	for _, suffix := range []string{promql.BucketSuffix, promql.SumSuffix, promql.CountSuffix} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			_, ok := exists[base+promql.BucketSuffix]
+			return base, ok
+		}
+	}
+	return "", false
+}
+
+func isHistogram(metadata []v1.Metadata) bool {
+	for _, md := range metadata {
+		if md.Type == v1.MetricTypeHistogram || md.Type == v1.MetricTypeGaugeHistogram {
+			return true
+		}
+	}
+	return false
+}
+
+// histogramNote describes which kind of histogram name is, if any, and how to
+// query it.
+func histogramNote(ctx context.Context, b *backend.Backend, name string, end time.Time) (string, error) {
+	buckets, err := b.LabelValues(ctx, model.BucketLabel, []string{fmt.Sprintf("{%s=%q}", labels.MetricName, name+promql.BucketSuffix)}, end.Add(-window), end, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(buckets.Value) > 0 {
+		h := promql.Histogram{Name: name}
+		for _, le := range buckets.Value {
+			h.Buckets = append(h.Buckets, string(le))
+		}
+		promql.SortBuckets(h.Buckets)
+		return fmt.Sprintf("It is a classic histogram exposed as %[1]s_bucket, %[1]s_sum and %[1]s_count, with %[2]d buckets le=%[3]s.\n"+
+			"Compute quantiles with histogram_quantile(0.99, sum by (le) (rate(%[1]s_bucket[5m]))).\n\n", name, len(h.Buckets), h.BucketSummary()), nil
+	}
+
+	native, err := b.NativeHistogram(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if native.Value {
+		return fmt.Sprintf("It is a native histogram, without _bucket series nor le label.\n"+
+			"Compute quantiles with histogram_quantile(0.99, sum(rate(%[1]s[5m]))), and use histogram_count, histogram_sum, histogram_avg and histogram_fraction on rate(%[1]s[5m]).\n\n", name), nil
+	}
+	return "", nil
+}
+
+func formatMetadata(name string, metadata []v1.Metadata) string {
+	if len(metadata) == 0 {
+		return name
+	}
+
+	// Metrics exposed by several targets may have differing metadata, in which
+	// case list the type of each but only the first help text.
+	types := map[string]struct{}{}
+	for _, md := range metadata {
+		types[string(md.Type)] = struct{}{}
+	}
+	typeList := make([]string, 0, len(types))
+	for t := range types {
+		typeList = append(typeList, t)
+	}
+	sort.Strings(typeList)
+
+	s := fmt.Sprintf("%s (%s)", name, strings.Join(typeList, ", "))
+	if metadata[0].Unit != "" {
+		s += " [" + metadata[0].Unit + "]"
+	}
+	if metadata[0].Help != "" {
+		s += ": " + metadata[0].Help
+	}
+	return s
+}
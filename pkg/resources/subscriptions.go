@@ -0,0 +1,73 @@
+package resources
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Subscriptions keeps track of which sessions are subscribed to which
+// resources, so that only those get notified when a resource changes.
+type Subscriptions struct {
+	mtx  sync.Mutex
+	subs map[string]map[string]struct{}
+}
+
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{subs: map[string]map[string]struct{}{}}
+}
+
+// Register adds the hooks that track subscriptions to hooks, which must be
+// passed to the MCP server.
+func (s *Subscriptions) Register(hooks *server.Hooks) {
+	hooks.AddAfterSubscribe(func(ctx context.Context, _ any, message *mcp.SubscribeRequest, _ *mcp.EmptyResult) {
+		session := server.ClientSessionFromContext(ctx)
+		if session == nil {
+			return
+		}
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if s.subs[message.Params.URI] == nil {
+			s.subs[message.Params.URI] = map[string]struct{}{}
+		}
+		s.subs[message.Params.URI][session.SessionID()] = struct{}{}
+	})
+	hooks.AddAfterUnsubscribe(func(ctx context.Context, _ any, message *mcp.UnsubscribeRequest, _ *mcp.EmptyResult) {
+		session := server.ClientSessionFromContext(ctx)
+		if session == nil {
+			return
+		}
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		delete(s.subs[message.Params.URI], session.SessionID())
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		for _, sessions := range s.subs {
+			delete(sessions, session.SessionID())
+		}
+	})
+}
+
+// Notify sends a resources/updated notification for uri to every session
+// subscribed to it.
+func (s *Subscriptions) Notify(srv *server.MCPServer, uri string) {
+	s.mtx.Lock()
+	sessions := make([]string, 0, len(s.subs[uri]))
+	for id := range s.subs[uri] {
+		sessions = append(sessions, id)
+	}
+	s.mtx.Unlock()
+
+	for _, id := range sessions {
+		if err := srv.SendNotificationToSpecificClient(id, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri}); err != nil {
+			slog.Warn("error notifying session of resource update", "session", id, "uri", uri, "error", err)
+		}
+	}
+}
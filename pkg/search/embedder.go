@@ -0,0 +1,215 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// similar the texts are in meaning.
+type Embedder interface {
+	// Name identifies the embedder and its model, vectors of embedders with
+	// different names are not comparable.
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+const (
+	// ngramDimensions is the number of dimensions of the vectors of the
+	// built-in embedder.
+	ngramDimensions = 512
+
+	// Weights of the features of the built-in embedder, concepts weigh the
+	// most as they are what relates words that look nothing alike.
+	wordWeight    = 1
+	conceptWeight = 3
+	trigramWeight = 0.3
+)
+
+// concepts groups words that mean the same in monitoring, so that e.g. a query
+// for "latency" is similar to metrics named after their duration_seconds.
+var concepts = [][]string{
+	{"latency", "latencies", "duration", "durations", "delay", "lag", "response", "slow", "slowness"},
+	{"memory", "mem", "rss", "heap", "ram", "oom", "oomkilled", "working"},
+	{"cpu", "cpus", "processor", "cores", "throttled", "throttling", "cfs"},
+	{"disk", "disks", "storage", "filesystem", "fs", "volume", "volumes", "io", "iops"},
+	{"network", "net", "bandwidth", "traffic", "packets", "receive", "transmit", "rx", "tx"},
+	{"error", "errors", "failed", "failure", "failures", "fail", "fails", "5xx", "exception", "exceptions"},
+	{"request", "requests", "calls", "rps", "qps", "throughput", "hits"},
+	{"restart", "restarts", "crash", "crashes", "crashloop", "crashloopbackoff"},
+	{"queue", "queued", "backlog", "pending", "waiting", "inflight"},
+	{"up", "available", "availability", "uptime", "ready", "readiness", "health", "healthy"},
+	{"connection", "connections", "conn", "conns", "sockets", "socket"},
+	{"gc", "garbage", "collection", "collector"},
+	{"size", "bytes", "usage", "used", "utilisation", "utilization"},
+}
+
+var conceptOf = func() map[string]int {
+	m := map[string]int{}
+	for i, words := range concepts {
+		for _, w := range words {
+			m[w] = i
+		}
+	}
+	return m
+}()
+
+// NgramEmbedder is a lightweight embedder that needs no model, hashing the
+// words of texts, their character trigrams and the concepts they belong to
+// into fixed-size vectors. Trigrams make it robust to word forms and typos,
+// and concepts give it a notion of common monitoring synonyms.
+type NgramEmbedder struct{}
+
+func (NgramEmbedder) Name() string {
+	return fmt.Sprintf("ngram-%d", ngramDimensions)
+}
+
+func (NgramEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, t := range texts {
+		// Features are only counted once, so that long help texts repeating
+		// the same words don't drown the rest.
+		features := map[string]float32{}
+		for _, w := range Tokenize(t) {
+			if _, ok := stopWords[w]; ok {
+				continue
+			}
+			features["w:"+w] = wordWeight
+			if c, ok := conceptOf[w]; ok {
+				features[fmt.Sprintf("c:%d", c)] = conceptWeight
+			}
+			padded := "^" + w + "$"
+			for i := 0; i+3 <= len(padded); i++ {
+				features["t:"+padded[i:i+3]] = trigramWeight
+			}
+		}
+
+		v := make([]float32, ngramDimensions)
+		for f, weight := range features {
+			addFeature(v, f, weight)
+		}
+		normalise(v)
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// addFeature adds weight to the dimension feature hashes to, with a sign also
+// derived from the hash so that collisions tend to cancel out.
+func addFeature(v []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	v[sum%uint64(len(v))] += weight
+}
+
+func normalise(v []float32) {
+	norm := 0.0
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+}
+
+// cosine returns the cosine similarity of a and b.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	dot, na, nb := 0.0, 0.0, 0.0
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// HTTPEmbedder embeds texts with an external service implementing the OpenAI
+// embeddings API, which most model servers, e.g. Ollama, vLLM or text
+// embeddings inference, do.
+type HTTPEmbedder struct {
+	// URL of the embeddings endpoint, e.g. http://localhost:11434/v1/embeddings.
+	URL     string
+	Model   string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewHTTPEmbedder returns an embedder sending requests to url for model.
+func NewHTTPEmbedder(url, model string, headers map[string]string) *HTTPEmbedder {
+	return &HTTPEmbedder{URL: url, Model: model, Headers: headers, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (e *HTTPEmbedder) Name() string {
+	return "http-" + e.Model
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{Model: e.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("requesting embeddings: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var res struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decoding embeddings: %w", err)
+	}
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("decoding embeddings: got %d embeddings for %d texts", len(res.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("decoding embeddings: invalid index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,209 @@
+// Package search ranks metrics against free-text queries, such as "disk
+// latency", by their names and help texts.
+package search
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+const (
+	// Weights of matches of query tokens against the tokens of names and help
+	// texts, names are a much stronger signal than help texts.
+	nameWeight = 3
+	helpWeight = 1
+
+	// Scores of the kinds of matches of a query token against a token.
+	exactMatch  = 1.0
+	prefixMatch = 0.8
+	fuzzyMatch  = 0.6
+
+	// minPrefix is the minimum length of a token for prefix matches.
+	minPrefix = 3
+	// minFuzzy is the minimum length of a token for fuzzy matches.
+	minFuzzy = 4
+
+	// minSimilarity is the minimum semantic similarity of documents to a query
+	// for them to match without any of its words.
+	minSimilarity = 0.25
+)
+
+// stopWords are ignored in queries, as they are common in questions like "what
+// metric tells me the disk latency" but never distinguish metrics.
+var stopWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "by": {}, "do": {}, "for": {}, "how": {}, "i": {}, "in": {}, "is": {},
+	"me": {}, "metric": {}, "metrics": {}, "my": {}, "of": {}, "on": {}, "or": {}, "per": {}, "show": {}, "tell": {},
+	"tells": {}, "that": {}, "the": {}, "to": {}, "what": {}, "which": {}, "with": {},
+}
+
+// Document is a metric to be searched.
+type Document struct {
+	Name, Type, Help, Unit string
+}
+
+// Match is a document matching a query.
+type Match struct {
+	Document
+	// Score is between 0 and 1, higher is better.
+	Score float64
+}
+
+type entry struct {
+	Document
+	name []string
+	help []string
+}
+
+// Index is an in-memory index of documents.
+type Index struct {
+	entries []entry
+}
+
+// New returns an index of docs.
+func New(docs []Document) *Index {
+	idx := &Index{entries: make([]entry, 0, len(docs))}
+	for _, d := range docs {
+		idx.entries = append(idx.entries, entry{Document: d, name: Tokenize(d.Name), help: Tokenize(d.Help)})
+	}
+	return idx
+}
+
+// Len returns the number of documents in the index.
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// Search returns up to n documents matching query, best first. Query tokens
+// are matched against the tokens of names and help texts exactly, as prefixes,
+// e.g. "req" for "requests", and fuzzily, e.g. "latncy" for "latency".
+func (idx *Index) Search(query string, n int) []Match {
+	return idx.Rank(query, n, nil, 0)
+}
+
+// Rank is like Search, but combines the lexical score of every document with
+// its semantic similarity to the query, by name, with the given weight between
+// 0 and 1. Documents that only match semantically must be at least
+// minSimilarity similar to the query.
+func (idx *Index) Rank(query string, n int, similarity map[string]float64, weight float64) []Match {
+	tokens := queryTokens(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+	phrase := strings.Join(tokens, "_")
+
+	var matches []Match
+	for _, e := range idx.entries {
+		score := e.score(tokens, phrase)
+		if similarity != nil {
+			sim := max(similarity[e.Name], 0)
+			if score == 0 && sim < minSimilarity {
+				continue
+			}
+			score = (1-weight)*score + weight*sim
+		}
+		if score > 0 {
+			matches = append(matches, Match{Document: e.Document, Score: score})
+		}
+	}
+	sortMatches(matches)
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// score returns how well the entry matches the query tokens, between 0 and 1.
+// Most of it comes from how well every query token matches the name and help
+// text, and the rest from how much of the name is covered by the query, to
+// favour concise names, and from the query appearing in the name as a whole.
+func (e entry) score(tokens []string, phrase string) float64 {
+	if strings.EqualFold(e.Name, phrase) {
+		return 1
+	}
+
+	total := 0.0
+	covered := map[string]struct{}{}
+	for _, t := range tokens {
+		name, matched := best(t, e.name)
+		help, _ := best(t, e.help)
+		total += nameWeight*name + helpWeight*help
+		if matched != "" {
+			covered[matched] = struct{}{}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	score := 0.8 * total / float64((nameWeight+helpWeight)*len(tokens))
+	score += 0.1 * float64(len(covered)) / float64(len(e.name))
+	if len(tokens) > 1 && strings.Contains(strings.ToLower(e.Name), phrase) {
+		score += 0.1
+	}
+	return score
+}
+
+// best returns the score of the best match of t among tokens, and the token.
+func best(t string, tokens []string) (float64, string) {
+	score, matched := 0.0, ""
+	for _, c := range tokens {
+		s := 0.0
+		switch {
+		case c == t:
+			s = exactMatch
+		case len(t) >= minPrefix && len(c) >= minPrefix && (strings.HasPrefix(c, t) || strings.HasPrefix(t, c)):
+			s = prefixMatch
+		case len(t) >= minFuzzy && len(c) >= minFuzzy && promql.Distance(t, c) <= fuzzyDistance(t):
+			s = fuzzyMatch
+		}
+		if s > score {
+			score, matched = s, c
+			if s == exactMatch {
+				break
+			}
+		}
+	}
+	return score, matched
+}
+
+// fuzzyDistance is the maximum edit distance of fuzzy matches of t.
+func fuzzyDistance(t string) int {
+	if len(t) >= 8 {
+		return 2
+	}
+	return 1
+}
+
+// sortMatches sorts matches by descending score, and then by name.
+func sortMatches(matches []Match) {
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// Tokenize splits s into lower case words, on anything that is not a letter or
+// a digit, e.g. http_requests_total into http, requests and total.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func queryTokens(query string) []string {
+	var tokens []string
+	for _, t := range Tokenize(query) {
+		if _, ok := stopWords[t]; !ok {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
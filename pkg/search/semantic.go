@@ -0,0 +1,369 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	EmbedderNone    = ""
+	EmbedderBuiltin = "builtin"
+	EmbedderHTTP    = "http"
+
+	// embedBatch is how many texts are embedded per request.
+	embedBatch = 64
+	// indexWait is how long a search waits for the vectors of new metrics to
+	// be embedded before ranking them lexically only.
+	indexWait = 2 * time.Second
+	// persistInterval is how often vectors are persisted while they are being
+	// embedded.
+	persistInterval = 10 * time.Second
+	// maxEphemeralStores is how many sets of vectors that aren't persisted,
+	// e.g. of tenants that aren't configured, are kept in memory at once.
+	maxEphemeralStores = 16
+)
+
+// DefaultConfig is the search configuration used if none is configured, with
+// semantic search disabled.
+var DefaultConfig = Config{SemanticWeight: 0.5}
+
+// Config configures the semantic index of metrics.
+type Config struct {
+	// Embedder is builtin for the built-in embedder, http for an external
+	// embeddings endpoint, or empty to disable semantic search.
+	Embedder string `yaml:"embedder"`
+	// EmbeddingURL is the URL of the OpenAI compatible embeddings endpoint
+	// used by the http embedder.
+	EmbeddingURL     string            `yaml:"embedding_url"`
+	EmbeddingModel   string            `yaml:"embedding_model"`
+	EmbeddingHeaders map[string]string `yaml:"embedding_headers"`
+	// IndexDir is the directory the vectors of metrics are persisted to, so
+	// that they aren't all embedded again on restarts. Empty keeps them in
+	// memory only.
+	IndexDir string `yaml:"index_dir"`
+	// SemanticWeight is the weight of the semantic score in the combined score
+	// of metrics, between 0 and 1, the rest being the weight of the lexical one.
+	SemanticWeight float64 `yaml:"semantic_weight"`
+}
+
+// Semantic keeps the vectors of the metrics of every datasource and tenant,
+// embedding only the metrics that are new or whose help text changed.
+type Semantic struct {
+	embedder Embedder
+	dir      string
+	weight   float64
+
+	mu     sync.Mutex
+	stores map[string]*vectorStore
+}
+
+// NewSemantic returns the semantic index configured by cfg, or nil if semantic
+// search is disabled.
+func NewSemantic(cfg Config) (*Semantic, error) {
+	var embedder Embedder
+	switch cfg.Embedder {
+	case EmbedderNone:
+		return nil, nil
+	case EmbedderBuiltin:
+		embedder = NgramEmbedder{}
+	case EmbedderHTTP:
+		if cfg.EmbeddingURL == "" || cfg.EmbeddingModel == "" {
+			return nil, errors.New("the http embedder needs an embedding_url and an embedding_model")
+		}
+		embedder = NewHTTPEmbedder(cfg.EmbeddingURL, cfg.EmbeddingModel, cfg.EmbeddingHeaders)
+	default:
+		return nil, fmt.Errorf("unknown embedder %q, expected builtin or http", cfg.Embedder)
+	}
+	if cfg.SemanticWeight < 0 || cfg.SemanticWeight > 1 {
+		return nil, errors.New("semantic_weight must be between 0 and 1")
+	}
+	if cfg.IndexDir != "" {
+		if err := os.MkdirAll(cfg.IndexDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating index directory: %w", err)
+		}
+	}
+	return &Semantic{embedder: embedder, dir: cfg.IndexDir, weight: cfg.SemanticWeight, stores: map[string]*vectorStore{}}, nil
+}
+
+// Weight returns the weight of the semantic score in the combined score.
+func (s *Semantic) Weight() float64 {
+	return s.weight
+}
+
+// IndexingError is returned by Scores while the vectors of a set of documents
+// are embedded for the first time, in the background.
+type IndexingError struct {
+	Embedded, Total int
+}
+
+func (e *IndexingError) Error() string {
+	return fmt.Sprintf("the semantic index is still being built, %d of %d metrics are embedded", e.Embedded, e.Total)
+}
+
+// Scores returns the cosine similarity of query to every one of docs, by name.
+// key identifies the set of documents, e.g. the datasource and tenant they
+// come from, and persist whether its vectors are persisted, if the index has a
+// directory. Documents that are new or changed are embedded in the background,
+// and score zero until they are. An IndexingError is returned until the
+// vectors of every document were embedded once.
+func (s *Semantic) Scores(ctx context.Context, key string, persist bool, docs []Document, query string) (map[string]float64, error) {
+	store := s.store(key, persist)
+	vectors, done, err := store.lookup(s.embedder, docs)
+	var indexing *IndexingError
+	if errors.As(err, &indexing) {
+		// Small sets of documents, or fast embedders, are embedded within
+		// the search.
+		select {
+		case <-done:
+			vectors, _, err = store.lookup(s.embedder, docs)
+		case <-time.After(indexWait):
+		case <-ctx.Done():
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(vectors))
+	for name, v := range vectors {
+		scores[name] = cosine(q[0], v)
+	}
+	return scores, nil
+}
+
+func (s *Semantic) store(key string, persist bool) *vectorStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.stores[key]; ok {
+		return st
+	}
+
+	st := &vectorStore{key: key, embedder: s.embedder.Name(), ephemeral: !persist, vectors: map[string][]float32{}, hashes: map[string]string{}}
+	if persist && s.dir != "" {
+		// Keys are hashed, so that any key makes a distinct and valid file
+		// name.
+		sum := sha256.Sum256([]byte(key))
+		st.path = filepath.Join(s.dir, hex.EncodeToString(sum[:16])+".gob")
+		st.load()
+	}
+	if st.ephemeral {
+		s.evictEphemeral()
+	}
+	s.stores[key] = st
+	return st
+}
+
+// evictEphemeral drops an ephemeral store once there are too many, so that
+// requests for arbitrary tenants don't grow the index without bounds.
+func (s *Semantic) evictEphemeral() {
+	var ephemeral []string
+	for key, st := range s.stores {
+		if st.ephemeral {
+			ephemeral = append(ephemeral, key)
+		}
+	}
+	if len(ephemeral) >= maxEphemeralStores {
+		delete(s.stores, ephemeral[0])
+	}
+}
+
+// vectorStore holds the vectors of a set of documents, persisted to path if
+// set.
+type vectorStore struct {
+	key       string
+	path      string
+	embedder  string
+	ephemeral bool
+
+	mu sync.Mutex
+	// vectors and hashes are keyed by document name, hashes are those of the
+	// texts the vectors were embedded from.
+	vectors map[string][]float32
+	hashes  map[string]string
+	// complete is whether the vectors of every document were embedded once,
+	// after which they are used while new documents are embedded.
+	complete bool
+	// refreshing is closed once the documents being embedded in the
+	// background are, and nil if none are.
+	refreshing chan struct{}
+	savedAt    time.Time
+}
+
+// persistedVectors is the on-disk format of vector stores.
+type persistedVectors struct {
+	Key      string
+	Embedder string
+	Vectors  map[string][]float32
+	Hashes   map[string]string
+}
+
+// load reads the persisted vectors, ignoring them if they were embedded by a
+// different embedder.
+func (st *vectorStore) load() {
+	f, err := os.Open(st.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("error reading metric vectors", "path", st.path, "error", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	var p persistedVectors
+	if err := gob.NewDecoder(f).Decode(&p); err != nil {
+		slog.Warn("error reading metric vectors", "path", st.path, "error", err)
+		return
+	}
+	if p.Key != st.key {
+		slog.Warn("ignoring metric vectors of another datasource", "path", st.path)
+		return
+	}
+	if p.Embedder != st.embedder {
+		slog.Info("ignoring metric vectors of another embedder", "path", st.path, "embedder", p.Embedder)
+		return
+	}
+	st.vectors, st.hashes, st.complete = p.Vectors, p.Hashes, true
+}
+
+// save persists the vectors, at most every persistInterval unless force is
+// set. It must be called with st.mu held.
+func (st *vectorStore) save(force bool) {
+	if st.path == "" || (!force && time.Since(st.savedAt) < persistInterval) {
+		return
+	}
+	st.savedAt = time.Now()
+	if err := st.write(); err != nil {
+		slog.Warn("error persisting metric vectors", "path", st.path, "error", err)
+	}
+}
+
+func (st *vectorStore) write() error {
+	tmp := st.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(persistedVectors{Key: st.key, Embedder: st.embedder, Vectors: st.vectors, Hashes: st.hashes}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// pending is a document waiting to be embedded.
+type pending struct {
+	name, text, hash string
+}
+
+// lookup returns the up to date vectors of docs, and starts embedding the docs
+// that are new or changed in the background, unless they already are. The
+// returned channel is closed once they are embedded. An IndexingError is
+// returned instead of the vectors until every document was embedded once.
+func (st *vectorStore) lookup(embedder Embedder, docs []Document) (map[string][]float32, <-chan struct{}, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	vectors := make(map[string][]float32, len(docs))
+	current := make(map[string]struct{}, len(docs))
+	var missing []pending
+	for _, d := range docs {
+		text := embeddingText(d)
+		sum := sha256.Sum256([]byte(text))
+		hash := hex.EncodeToString(sum[:8])
+		current[d.Name] = struct{}{}
+		if v, ok := st.vectors[d.Name]; ok && st.hashes[d.Name] == hash {
+			vectors[d.Name] = v
+			continue
+		}
+		missing = append(missing, pending{name: d.Name, text: text, hash: hash})
+	}
+	if len(missing) == 0 {
+		st.complete = true
+		return vectors, nil, nil
+	}
+
+	if st.refreshing == nil {
+		st.refreshing = make(chan struct{})
+		go st.embed(embedder, missing, current, st.refreshing)
+	}
+	if !st.complete {
+		return nil, st.refreshing, &IndexingError{Embedded: len(vectors), Total: len(docs)}
+	}
+	return vectors, st.refreshing, nil
+}
+
+// embed embeds docs in batches, keeping and persisting the vectors of every
+// batch as soon as it is embedded, and drops the vectors of the documents that
+// aren't current anymore once every doc is embedded.
+func (st *vectorStore) embed(embedder Embedder, docs []pending, current map[string]struct{}, done chan struct{}) {
+	defer func() {
+		st.mu.Lock()
+		st.refreshing = nil
+		st.mu.Unlock()
+		close(done)
+	}()
+
+	for i := 0; i < len(docs); i += embedBatch {
+		batch := docs[i:min(i+embedBatch, len(docs))]
+		texts := make([]string, 0, len(batch))
+		for _, d := range batch {
+			texts = append(texts, d.text)
+		}
+		embedded, err := embedder.Embed(context.Background(), texts)
+		if err == nil && len(embedded) != len(batch) {
+			err = fmt.Errorf("got %d vectors for %d texts", len(embedded), len(batch))
+		}
+		if err != nil {
+			slog.Warn("error embedding metrics", "embedded", i, "metrics", len(docs), "error", err)
+			st.mu.Lock()
+			st.save(true)
+			st.mu.Unlock()
+			return
+		}
+
+		st.mu.Lock()
+		for j, v := range embedded {
+			st.vectors[batch[j].name] = v
+			st.hashes[batch[j].name] = batch[j].hash
+		}
+		st.save(false)
+		st.mu.Unlock()
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for name := range st.vectors {
+		if _, ok := current[name]; !ok {
+			delete(st.vectors, name)
+			delete(st.hashes, name)
+		}
+	}
+	st.complete = true
+	slog.Debug("embedded new metrics", "metrics", len(docs), "path", st.path)
+	st.save(true)
+}
+
+// embeddingText returns the text a document is embedded from.
+func embeddingText(d Document) string {
+	text := d.Name + " " + d.Type
+	if d.Help != "" {
+		text += ": " + d.Help
+	}
+	return text
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// flakyEmbedder embeds texts with the built-in embedder, failing every call
+// after the first ok ones.
+type flakyEmbedder struct {
+	NgramEmbedder
+
+	mu    sync.Mutex
+	ok    int
+	calls int
+}
+
+func (e *flakyEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	if e.calls > e.ok {
+		return nil, errors.New("unavailable")
+	}
+	return e.NgramEmbedder.Embed(ctx, texts)
+}
+
+func documents(n int) []Document {
+	docs := make([]Document, 0, n)
+	for i := range n {
+		docs = append(docs, Document{Name: fmt.Sprintf("metric_%d_seconds", i), Type: "gauge"})
+	}
+	return docs
+}
+
+func TestScoresKeepEmbeddedBatches(t *testing.T) {
+	embedder := &flakyEmbedder{ok: 1}
+	s := &Semantic{embedder: embedder, dir: t.TempDir(), stores: map[string]*vectorStore{}}
+	docs := documents(embedBatch + 1)
+
+	var indexing *IndexingError
+	if _, err := s.Scores(context.Background(), "prometheus", true, docs, "latency"); !errors.As(err, &indexing) {
+		t.Fatalf("expected an indexing error after a failed batch, got %v", err)
+	}
+	st := s.store("prometheus", true)
+	st.mu.Lock()
+	refreshing := st.refreshing
+	st.mu.Unlock()
+	if refreshing != nil {
+		<-refreshing
+	}
+	st.mu.Lock()
+	embedded := len(st.vectors)
+	st.mu.Unlock()
+	if embedded != embedBatch {
+		t.Fatalf("got %d vectors, expected the %d of the first batch to be kept", embedded, embedBatch)
+	}
+
+	// The next search only embeds the rest, and the vectors are persisted
+	// for a new index to start from.
+	embedder.mu.Lock()
+	embedder.ok = 1 << 30
+	embedder.mu.Unlock()
+	scores, err := s.Scores(context.Background(), "prometheus", true, docs, "latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != len(docs) {
+		t.Fatalf("got %d scores, expected %d", len(scores), len(docs))
+	}
+
+	restarted := &Semantic{embedder: &flakyEmbedder{}, dir: s.dir, stores: map[string]*vectorStore{}}
+	if _, err := restarted.Scores(context.Background(), "prometheus", true, docs, "latency"); err == nil {
+		t.Fatal("expected the query to be embedded by the failing embedder")
+	} else if errors.As(err, &indexing) {
+		t.Fatalf("expected the persisted vectors to be used, got %v", err)
+	}
+}
+
+func TestStoreFiles(t *testing.T) {
+	s := &Semantic{embedder: NgramEmbedder{}, dir: t.TempDir(), stores: map[string]*vectorStore{}}
+	docs := documents(3)
+	for _, key := range []string{"a_b", "a/b", "../../etc"} {
+		if _, err := s.Scores(context.Background(), key, true, docs, "latency"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range maxEphemeralStores + 2 {
+		if _, err := s.Scores(context.Background(), fmt.Sprintf("prometheus/tenant-%d", i), false, docs, "latency"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("got %d files, expected one for every persisted key", len(files))
+	}
+	if len(s.stores) != 3+maxEphemeralStores {
+		t.Errorf("got %d stores, expected %d", len(s.stores), 3+maxEphemeralStores)
+	}
+}
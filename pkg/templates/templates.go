@@ -0,0 +1,253 @@
+package templates
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed builtin.yaml
+var builtin []byte
+
+// Parameter types, which determine how the values of parameters are validated.
+const (
+	// TypeMetric is a metric name, e.g. http_requests_total.
+	TypeMetric = "metric"
+	// TypeMatchers is a comma separated list of label matchers, e.g.
+	// job="api", code=~"5..".
+	TypeMatchers = "matchers"
+	// TypeLabels is a comma separated list of label names, e.g. job, route.
+	TypeLabels = "labels"
+	// TypeDuration is a Prometheus duration, e.g. 5m.
+	TypeDuration = "duration"
+	// TypeNumber is a floating point number, e.g. 0.99.
+	TypeNumber = "number"
+	// TypeString is any string that doesn't contain quotes or backslashes.
+	TypeString = "string"
+)
+
+var placeholder = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}|\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// Parameter is a typed parameter of a query template.
+type Parameter struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	// Default is the value of the parameter if it isn't given. Parameters
+	// without a default are required.
+	Default *string `yaml:"default,omitempty"`
+}
+
+// Template is a named, parameterised PromQL query. The query references
+// parameters as $name or ${name}.
+type Template struct {
+	Name        string      `yaml:"name"`
+	Description string      `yaml:"description"`
+	Parameters  []Parameter `yaml:"parameters"`
+	Query       string      `yaml:"query"`
+}
+
+type file struct {
+	Templates []Template `yaml:"templates"`
+}
+
+// Library is a set of query templates.
+type Library struct {
+	templates []Template
+}
+
+// Load returns the library of the built-in templates along with those defined
+// in the YAML files in dir, if it is not empty. Templates in dir replace built-in
+// templates of the same name.
+func Load(dir string) (*Library, error) {
+	l := &Library{}
+	if err := l.add(builtin, "built-in templates"); err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return l, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	yml, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range append(files, yml...) {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading query templates: %w", err)
+		}
+		if err := l.add(b, f); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *Library) add(b []byte, source string) error {
+	var f file
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("parsing query templates from %s: %w", source, err)
+	}
+
+	for _, t := range f.Templates {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("invalid query template %q in %s: %w", t.Name, source, err)
+		}
+		l.templates = slices.DeleteFunc(l.templates, func(e Template) bool { return e.Name == t.Name })
+		l.templates = append(l.templates, t)
+	}
+	slices.SortFunc(l.templates, func(a, b Template) int { return strings.Compare(a.Name, b.Name) })
+	return nil
+}
+
+// List returns every template in the library, sorted by name.
+func (l *Library) List() []Template {
+	return l.templates
+}
+
+// Get returns the template with the given name.
+func (l *Library) Get(name string) (Template, error) {
+	for _, t := range l.templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	names := make([]string, 0, len(l.templates))
+	for _, t := range l.templates {
+		names = append(names, t.Name)
+	}
+	return Template{}, fmt.Errorf("unknown query template %q, available templates are: %s", name, strings.Join(names, ", "))
+}
+
+func (t Template) validate() error {
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+	if t.Query == "" {
+		return errors.New("query is required")
+	}
+
+	params := map[string]struct{}{}
+	for _, p := range t.Parameters {
+		if _, ok := params[p.Name]; ok {
+			return fmt.Errorf("parameter %q is defined more than once", p.Name)
+		}
+		params[p.Name] = struct{}{}
+		if err := checkValue(p.Type, ""); errors.Is(err, errUnknownType) {
+			return fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+		if p.Default != nil {
+			if err := checkValue(p.Type, *p.Default); err != nil {
+				return fmt.Errorf("default of parameter %q: %w", p.Name, err)
+			}
+		}
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(t.Query, -1) {
+		name := m[1] + m[2]
+		if _, ok := params[name]; !ok {
+			return fmt.Errorf("query references undefined parameter %q", name)
+		}
+	}
+	return nil
+}
+
+// Render fills in the parameters of the template with values, falling back to
+// their defaults, and returns the resulting query after checking that it is
+// valid PromQL.
+func (t Template) Render(values map[string]string) (string, error) {
+	resolved := map[string]string{}
+	for _, p := range t.Parameters {
+		v, ok := values[p.Name]
+		if !ok {
+			if p.Default == nil {
+				return "", fmt.Errorf("parameter %q is required: %s", p.Name, p.Description)
+			}
+			v = *p.Default
+		}
+		v = strings.TrimSpace(v)
+		if err := checkValue(p.Type, v); err != nil {
+			return "", fmt.Errorf("invalid value for parameter %q: %w", p.Name, err)
+		}
+		resolved[p.Name] = v
+	}
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return "", fmt.Errorf("template %q has no parameter %q", t.Name, name)
+		}
+	}
+
+	query := placeholder.ReplaceAllStringFunc(t.Query, func(s string) string {
+		m := placeholder.FindStringSubmatch(s)
+		return resolved[m[1]+m[2]]
+	})
+
+	expr, err := promql.Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("rendered query %s is not valid PromQL: %w", query, err)
+	}
+	return expr.String(), nil
+}
+
+var (
+	errUnknownType = errors.New("unknown parameter type")
+	metricName     = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
+func checkValue(typ, v string) error {
+	switch typ {
+	case TypeMetric:
+		if v != "" && !metricName.MatchString(v) {
+			return fmt.Errorf("%q is not a valid metric name", v)
+		}
+	case TypeMatchers:
+		if v == "" {
+			return nil
+		}
+		if _, err := parser.ParseMetricSelector("{" + v + "}"); err != nil {
+			return fmt.Errorf("%q is not a valid list of label matchers, e.g. job=\"api\", code=~\"5..\": %w", v, err)
+		}
+	case TypeLabels:
+		for _, l := range strings.Split(v, ",") {
+			if l = strings.TrimSpace(l); l != "" && !model.LabelName(l).IsValidLegacy() {
+				return fmt.Errorf("%q is not a valid label name", l)
+			}
+		}
+	case TypeDuration:
+		if v == "" {
+			return nil
+		}
+		if _, err := model.ParseDuration(v); err != nil {
+			return err
+		}
+	case TypeNumber:
+		if v == "" {
+			return nil
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+	case TypeString:
+		if strings.ContainsAny(v, "\"\\") {
+			return fmt.Errorf("%q must not contain quotes or backslashes", v)
+		}
+	default:
+		return fmt.Errorf("%w %q", errUnknownType, typ)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+const (
+	GetAlertsToolDescription = `Allows you to get the active, i.e. pending or firing, alerts from Prometheus by querying the api/v1/alerts endpoint.
+An example output of this tool would be like the following,
+
+We have the following alerts:
+
+firing: {alertname="KubePodCrashLooping", namespace="default", pod="api-0", severity="warning"} since 2024-01-01T10:00:00Z, value 1
+  summary: Pod is crash looping.
+...
+
+Use this tool to find out which alerts are currently going off, and the labels of the series that caused them.`
+
+	GetRulesToolDescription = `Allows you to get the alerting and recording rules from Prometheus by querying the api/v1/rules endpoint.
+An example output of this tool would be like the following,
+
+We have the following rules:
+
+alert KubePodCrashLooping (group kubernetes-apps, state firing, for 15m):
+  expr: max_over_time(kube_pod_container_status_waiting_reason{reason="CrashLoopBackOff"}[5m]) >= 1
+  labels: {severity="warning"}
+  summary: Pod is crash looping.
+record namespace:container_cpu_usage:sum (group k8s.rules):
+  expr: sum by (namespace) (rate(container_cpu_usage_seconds_total[5m]))
+...
+
+Use this tool to find the PromQL expression behind an alert, or to find recording rules that already compute what you need.`
+)
+
+func GetAlerts(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_get_alerts",
+			mcp.WithDescription(GetAlertsToolDescription),
+			mcp.WithString("alertname",
+				mcp.Description("Only return alerts with this name.")),
+			mcp.WithString("state",
+				mcp.Description("Only return alerts in this state."),
+				mcp.Enum(string(v1.AlertStateFiring), string(v1.AlertStatePending))),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			alertname, _ := args["alertname"].(string)
+			state, _ := args["state"].(string)
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			res, err := v1.NewAPI(b.Client).Alerts(ctx)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+
+			alerts := slices.DeleteFunc(res.Alerts, func(a v1.Alert) bool {
+				return (alertname != "" && string(a.Labels[model.AlertNameLabel]) != alertname) ||
+					(state != "" && string(a.State) != state)
+			})
+			if len(alerts) == 0 {
+				return mcp.NewToolResultText("There are no matching active alerts."), nil
+			}
+			slices.SortFunc(alerts, func(a, b v1.Alert) int {
+				return strings.Compare(a.Labels.String(), b.Labels.String())
+			})
+
+			var sb strings.Builder
+			sb.WriteString("We have the following alerts:\n\n")
+			for _, a := range alerts {
+				fmt.Fprintf(&sb, "%s: %s since %s, value %s\n", a.State, a.Labels, a.ActiveAt.Format(time.RFC3339), a.Value)
+				writeAnnotations(&sb, a.Annotations)
+			}
+
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
+
+func GetRules(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_get_rules",
+			mcp.WithDescription(GetRulesToolDescription),
+			mcp.WithString("name",
+				mcp.Description("Only return rules with this name, i.e. the alert name of an alerting rule or the metric name of a recording rule.")),
+			mcp.WithString("type",
+				mcp.Description("Only return rules of this type."),
+				mcp.Enum("alert", "record")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			name, _ := args["name"].(string)
+			ruleType, _ := args["type"].(string)
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			res, err := v1.NewAPI(b.Client).Rules(ctx)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+
+			var sb strings.Builder
+			for _, g := range res.Groups {
+				for _, r := range g.Rules {
+					switch r := r.(type) {
+					case v1.AlertingRule:
+						if (name != "" && r.Name != name) || ruleType == "record" {
+							continue
+						}
+						fmt.Fprintf(&sb, "alert %s (group %s, state %s, for %s):\n", r.Name, g.Name, r.State, model.Duration(time.Duration(r.Duration*float64(time.Second))))
+						fmt.Fprintf(&sb, "  expr: %s\n", r.Query)
+						if len(r.Labels) > 0 {
+							fmt.Fprintf(&sb, "  labels: %s\n", r.Labels)
+						}
+						writeAnnotations(&sb, r.Annotations)
+						if r.LastError != "" {
+							fmt.Fprintf(&sb, "  last error: %s\n", r.LastError)
+						}
+					case v1.RecordingRule:
+						if (name != "" && r.Name != name) || ruleType == "alert" {
+							continue
+						}
+						fmt.Fprintf(&sb, "record %s (group %s):\n", r.Name, g.Name)
+						fmt.Fprintf(&sb, "  expr: %s\n", r.Query)
+						if r.LastError != "" {
+							fmt.Fprintf(&sb, "  last error: %s\n", r.LastError)
+						}
+					}
+				}
+			}
+			if sb.Len() == 0 {
+				return mcp.NewToolResultText("There are no matching rules."), nil
+			}
+
+			return mcp.NewToolResultText("We have the following rules:\n\n" + sb.String()), nil
+		}
+}
+
+func writeAnnotations(sb *strings.Builder, annotations model.LabelSet) {
+	names := make([]string, 0, len(annotations))
+	for name := range annotations {
+		names = append(names, string(name))
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(sb, "  %s: %s\n", name, annotations[model.LabelName(name)])
+	}
+}
@@ -0,0 +1,16 @@
+package tools
+
+import (
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// withBudgetArguments adds the arguments that lower the budget of the response
+// of a tool call below the server-wide one.
+func withBudgetArguments() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithNumber("max_tokens",
+			mcp.Description("The maximum number of tokens of the response, which is summarised or truncated to fit. Can only lower the limit configured for the server."))(t)
+		mcp.WithNumber("max_bytes",
+			mcp.Description("The maximum number of bytes of the response, which is summarised or truncated to fit. Can only lower the limit configured for the server."))(t)
+	}
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/environment"
+)
+
+const (
+	CapabilitiesToolDescription = `Reports the flavour of the Prometheus-compatible datasource, e.g. Prometheus, Thanos, Mimir or VictoriaMetrics,
+along with which PromQL features it supports, such as native histogram functions, experimental functions like limitk and sort_by_label,
+or MetricsQL extensions. Features are detected by running tiny test queries against the datasource, and refreshed periodically.
+
+An example output of this tool would be like the following,
+
+The datasource prometheus is Prometheus 3.1.0. Its capabilities were probed 2m0s ago:
+
+supported: native_histograms, functions working on native histograms (histogram_avg, histogram_count, histogram_fraction, histogram_stddev, histogram_stdvar, histogram_sum)
+unsupported: limitk, experimental aggregations returning a subset of series (limitk, limit_ratio)
+unsupported: metricsql, MetricsQL extensions of VictoriaMetrics, e.g. keep_last_value
+
+Use this tool before generating a query that relies on functions which not every backend supports.`
+)
+
+func Capabilities(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_capabilities",
+			mcp.WithDescription(CapabilitiesToolDescription),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx, b, err := datasource(ctx, backends, request.GetArguments())
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			env := b.Environment()
+			if env == nil {
+				env, err = b.DiscoverEnvironment(ctx)
+				if err != nil {
+					slog.Error("error querying Prometheus", "error", err)
+					return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+				}
+			}
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "The datasource %s is %s", b.Name, env.Flavour)
+			if env.Version != "" {
+				sb.WriteString(" " + env.Version)
+			}
+			fmt.Fprintf(&sb, ". Its capabilities were probed %s ago:\n\n", model.Duration(time.Since(env.Capabilities.ProbedAt).Truncate(time.Second)))
+			for _, c := range environment.Capabilities {
+				fmt.Fprintf(&sb, "%s: %s, %s", env.Capabilities.Support[c.Name], c.Name, c.Description)
+				if len(c.Functions) > 0 {
+					fmt.Fprintf(&sb, " (%s)", strings.Join(c.Functions, ", "))
+				}
+				sb.WriteString("\n")
+			}
+
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+const (
+	EstimateCostToolDescription = `Estimates how expensive a PromQL query would be to run, without running it.
+For every selector in the expression, the number of matching series is counted using the api/v1/series endpoint, and the number of
+samples touched is derived from the scrape interval, the range of the selector and the number of evaluation steps.
+Queries that exceed the configured limits are flagged.
+
+An example output of this tool would be like the following,
+
+Estimated cost of a range query over the last 1h at a 1m step (61 steps):
+
+rate(http_requests_total[5m]): 120 series, 1200 samples per step
+Total: 120 series, 73200 samples
+
+The query is within the configured limits.
+
+Use this tool before running or handing the user a query that might match many series or cover a long time range.`
+
+	defaultCostStep = time.Minute
+)
+
+func EstimateCost(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("promql_estimate_cost",
+			mcp.WithDescription(EstimateCostToolDescription),
+			mcp.WithString("query", mcp.Required(),
+				mcp.Description("The PromQL expression to estimate the cost of.")),
+			mcp.WithString("range",
+				mcp.Description("The time range of the range query ending now, as a Prometheus duration, e.g. 1h or 7d. If not set, the cost of an instant query is estimated.")),
+			mcp.WithString("step",
+				mcp.Description("The step of the range query, as a Prometheus duration, e.g. 30s. Defaults to 1m. Ignored for instant queries.")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			query, ok := args["query"].(string)
+			if !ok {
+				return mcp.NewToolResultError("invalid type for 'query', expected string"), nil
+			}
+			queryRange, err := durationArg(args, "range", 0)
+			if err != nil {
+				return mcp.NewToolResultError("invalid 'range': " + err.Error()), nil
+			}
+			step, err := durationArg(args, "step", defaultCostStep)
+			if err != nil {
+				return mcp.NewToolResultError("invalid 'step': " + err.Error()), nil
+			}
+			if step <= 0 {
+				return mcp.NewToolResultError("invalid 'step': must be greater than zero"), nil
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			end := time.Now()
+			start := end
+			if queryRange > 0 {
+				start = end.Add(-queryRange)
+				if err := b.Guard.CheckRange(start, end); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if err := b.Guard.CheckStep(step); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+			} else {
+				step = 0
+			}
+
+			selectors, err := promql.Selectors(query)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := b.Guard.CheckSelectors(selectors); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			est, err := b.Estimator.Estimate(ctx, query, start, end, step)
+			if err != nil {
+				slog.Error("error estimating query cost", "error", err)
+				return mcp.NewToolResultError("error estimating query cost: " + err.Error()), nil
+			}
+
+			var sb strings.Builder
+			if queryRange > 0 {
+				fmt.Fprintf(&sb, "Estimated cost of a range query over the last %s at a %s step (%d steps):\n\n", model.Duration(queryRange), model.Duration(step), est.Steps)
+			} else {
+				sb.WriteString("Estimated cost of an instant query:\n\n")
+			}
+			for _, sc := range est.Selectors {
+				sel := sc.Selector.String()
+				if sc.Selector.Range > 0 {
+					sel += "[" + model.Duration(sc.Selector.Range).String() + "]"
+				}
+				if sc.Capped {
+					fmt.Fprintf(&sb, "%s: more than %d series, at least %d samples per step\n", sel, sc.Series-1, sc.SamplesPerStep)
+					continue
+				}
+				fmt.Fprintf(&sb, "%s: %d series, %d samples per step\n", sel, sc.Series, sc.SamplesPerStep)
+			}
+			if est.Capped {
+				fmt.Fprintf(&sb, "Total: at least %d series, %d samples\n\n", est.Series, est.Samples)
+			} else {
+				fmt.Fprintf(&sb, "Total: %d series, %d samples\n\n", est.Series, est.Samples)
+			}
+
+			if len(est.Violations) == 0 {
+				sb.WriteString("The query is within the configured limits.")
+				return mcp.NewToolResultText(sb.String()), nil
+			}
+			sb.WriteString("The query EXCEEDS the configured limits, it:\n")
+			for _, v := range est.Violations {
+				sb.WriteString("- " + v + "\n")
+			}
+			sb.WriteString("Narrow down the selectors with more specific label matchers, or shorten the time range or range windows.")
+
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+)
+
+// withDatasourceArguments adds the arguments that select which datasource, and
+// which tenant of it, a tool call is made against.
+func withDatasourceArguments() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithString("datasource",
+			mcp.Description("The name of the Prometheus datasource to use. Defaults to the first configured datasource."))(t)
+		mcp.WithString("tenant",
+			mcp.Description("The tenant to use on multi-tenant datasources. Defaults to the tenant configured for the datasource."))(t)
+	}
+}
+
+// datasource returns the backend selected by the arguments of a tool call, and
+// a context that makes requests against it for the selected tenant.
+func datasource(ctx context.Context, backends *backend.Set, args map[string]any) (context.Context, *backend.Backend, error) {
+	name, _ := args["datasource"].(string)
+	b, err := backends.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tenant, _ := args["tenant"].(string)
+	ctx, err = b.WithTenant(ctx, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctx, b, nil
+}
+
+// durationArg returns the duration argument with the given name, or def if it
+// isn't set.
+func durationArg(args map[string]any, name string, def time.Duration) (time.Duration, error) {
+	s, ok := args[name].(string)
+	if !ok || s == "" {
+		return def, nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(d), nil
+}
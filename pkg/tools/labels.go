@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
+)
+
+const (
+	GetLabelValuesToolDescription = `Allows you to get the values of a label over the last hour by querying the api/v1/label/<label>/values endpoint,
+optionally only on the series matching a fully constructed PromQL expr.
+An example output of this tool would be like the following,
+
+We have the following values of the namespace label (1-3 of 12):
+
+default
+kube-system
+monitoring
+
+There are more values of the namespace label, call this tool again with the cursor argument set to "..." to get the next page.
+
+Values are ordered alphabetically, and large results are split into pages that stay consistent with the first one for a few minutes.
+Use this tool to find the exact values to put in label matchers, instead of guessing them.`
+
+	GetMetricNamesToolDescription = `Allows you to get the names of the metrics with series over the last hour by querying the api/v1/label/__name__/values endpoint,
+optionally only of the series matching a fully constructed PromQL expr.
+An example output of this tool would be like the following,
+
+We have the following metric names (1-3 of 1520):
+
+apiserver_request_duration_seconds_bucket
+apiserver_request_total
+container_cpu_usage_seconds_total
+
+There are more metric names, call this tool again with the cursor argument set to "..." to get the next page.
+
+Names are ordered alphabetically, and large results are split into pages that stay consistent with the first one for a few minutes.
+Walk through the pages to browse the whole catalog of metrics, rather than trying regular expressions against __name__ with prometheus_get_series.`
+
+	// labelValuesWindow is how far back to look for label values.
+	labelValuesWindow = time.Hour
+)
+
+func GetLabelValues(backends *backend.Set, pages *pagination.Store) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_get_label_values",
+			mcp.WithDescription(GetLabelValuesToolDescription),
+			mcp.WithString("label",
+				mcp.Description("The name of the label to get the values of. Required unless cursor is set.")),
+			mcp.WithString("match",
+				mcp.Description("A fully constructed PromQL expr to only get the values of the label on the series it matches.")),
+			withDatasourceArguments(),
+			withPaginationArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			label, _ := args["label"].(string)
+			if label == model.MetricNameLabel {
+				return mcp.NewToolResultError("use prometheus_get_metric_names to get the names of metrics"), nil
+			}
+			return labelValues(ctx, backends, pages, "prometheus_get_label_values", "values of the "+label+" label", label, args)
+		}
+}
+
+func GetMetricNames(backends *backend.Set, pages *pagination.Store) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_get_metric_names",
+			mcp.WithDescription(GetMetricNamesToolDescription),
+			mcp.WithString("match",
+				mcp.Description("A fully constructed PromQL expr to only get the names of the metrics of the series it matches.")),
+			withDatasourceArguments(),
+			withPaginationArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return labelValues(ctx, backends, pages, "prometheus_get_metric_names", "metric names", model.MetricNameLabel, request.GetArguments())
+		}
+}
+
+// labelValues pages through the values of label, called what in the output, on
+// behalf of tool.
+func labelValues(ctx context.Context, backends *backend.Set, pages *pagination.Store, tool, what, label string, args map[string]any) (*mcp.CallToolResult, error) {
+	ctx, b, err := datasource(ctx, backends, args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	pg, err := pagingArgs(ctx, tool, b, args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if pg.cursor != "" {
+		page, err := pg.next(ctx, pages)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(formatPage(page)), nil
+	}
+
+	if label == "" {
+		return mcp.NewToolResultError("invalid 'label', expected a label name"), nil
+	}
+	var matches []string
+	if match, _ := args["match"].(string); match != "" {
+		if err := b.Guard.CheckMatch(match); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		matches = []string{match}
+	}
+
+	end := time.Now()
+	res, err := b.LabelValues(ctx, label, matches, end.Add(-labelValuesWindow), end, 0)
+	if err != nil {
+		slog.Error("error querying Prometheus", "error", err)
+		return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+	}
+	if len(res.Value) == 0 {
+		return mcp.NewToolResultText("There are no " + what + "."), nil
+	}
+
+	values := make([]string, 0, len(res.Value))
+	for _, v := range res.Value {
+		values = append(values, string(v))
+	}
+	slices.Sort(values)
+
+	txt := formatPage(pg.first(ctx, pages, what, values))
+	if note := res.CacheNote(); note != "" {
+		txt += "\n" + note + "\n"
+	}
+	return mcp.NewToolResultText(txt), nil
+}
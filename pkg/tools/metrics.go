@@ -2,60 +2,323 @@ package tools
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-	"github.com/prometheus/client_golang/api"
-	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+	"github.com/saswatamcode/promql-mcp/pkg/environment"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
 )
 
 const (
+	classicHistogramHint = `Query classic histograms through their _bucket series and its le label, e.g. histogram_quantile(0.99, sum by (le) (rate(<name>_bucket[5m]))),
+and use rate(<name>_sum[5m]) / rate(<name>_count[5m]) for averages.`
+	nativeHistogramHint = `Query native histograms directly, as they have no _bucket series nor le label, e.g. histogram_quantile(0.99, sum(rate(<name>[5m]))),
+and use histogram_count, histogram_sum, histogram_avg and histogram_fraction on rate(<name>[5m]) instead of _count and _sum series.`
+
+	// maxNativeHistogramProbes is how many metrics of a series result are
+	// probed for being native histograms.
+	maxNativeHistogramProbes = 10
+
+	seriesOutputFull    = "full"
+	seriesOutputSummary = "summary"
+	defaultTopValues    = 5
+
 	GetSeriesToolDescription = `Allows you to get only series from Prometheus by querying the api/v1/series endpoint with a match param that is fully constructed PromQL expr.
 An example output of this tool would be like the following,
 
 We have the following series:
 
+http_request_duration_seconds is a classic histogram with 12 buckets le=0.005, 0.01, 0.025, 0.05, ..., 2.5, 5, 10, +Inf, and the following series of _bucket, _sum and _count:
+{job="api", route="/"}
+rpc_duration_seconds is a native histogram, with the following series:
+{job="api"}
 {__name__="some_metric", container="some_container"...}
 ...
 
+Classic histograms are grouped under their base name, and native histograms are detected on datasources that support them and called out, along with how to query them.
+
+When the output argument is set to summary, series are instead grouped by metric name, and every metric is summarised by its number of
+series and, for every label, its number of distinct values and the most common ones along with how many series have them, like the following,
+
+We have the following series, summarised by metric:
+
+http_requests_total: 120 series
+  code (4 values): 200 (90), 500 (20), 404 (8), 503 (2)
+  job (1 values): api (120)
+  route (30 values): / (12), /login (10), /api/users (8), /api/orders (6), /healthz (4), ...
+
+Prefer the summary output when exploring, as it takes a fraction of the space of the full list of series.
+Responses that exceed the budget of the call are summarised by metric, or reduced to the metric names, and say so at the top, along with
+a cursor to page through every series instead. When the page_size or cursor argument is set, series are listed one per line in pages,
+ordered by their labels, with the cursor of the next page at the end.
+
+Identical requests made shortly after each other are served from a cache, which is noted at the end of the output.
+
 You can actually use this tool to figure out what metrics are available within the Prometheus instance.
 With this knowledge, you can then choose to optionally generate PromQL queries to give they user the data they want or to answer their question.
-DO NOT try to get ALL series from this tool using match params like __name__=~\".*\".`
+DO NOT try to get ALL series from this tool using match params like __name__=~\".*\", such requests are rejected.
+Requests that match too many series are rejected as well, in which case retry with more specific label matchers.`
 )
 
-func GetSeries(client api.Client) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+func GetSeries(backends *backend.Set, pages *pagination.Store) (tool mcp.Tool, handler server.ToolHandlerFunc) {
 	return mcp.NewTool("prometheus_get_series",
 			mcp.WithDescription(GetSeriesToolDescription),
-			mcp.WithString("match", mcp.Required(),
-				mcp.Description("A fully constructed PromQL expr to match the series that will be sent as a match[] arg to the api/v1/series endpoint."))),
+			mcp.WithString("match",
+				mcp.Description("A fully constructed PromQL expr to match the series that will be sent as a match[] arg to the api/v1/series endpoint. Required unless cursor is set.")),
+			mcp.WithString("output",
+				mcp.Description("How to output the series, full lists every series, summary summarises them by metric. Defaults to full."),
+				mcp.Enum(seriesOutputFull, seriesOutputSummary)),
+			mcp.WithNumber("top",
+				mcp.Description("How many of the most common values of every label to list in the summary output. Defaults to 5.")),
+			withDatasourceArguments(),
+			withPaginationArguments(),
+			withBudgetArguments()),
 		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			args := request.GetArguments()
-			match, ok := args["match"].(string)
-			if !ok {
-				return mcp.NewToolResultError("invalid type for 'match', expected string"), nil
+			match, _ := args["match"].(string)
+
+			output, _ := args["output"].(string)
+			if output == "" {
+				output = seriesOutputFull
+			}
+			if output != seriesOutputFull && output != seriesOutputSummary {
+				return mcp.NewToolResultError("invalid 'output', expected full or summary"), nil
+			}
+			top := defaultTopValues
+			if v, ok := args["top"].(float64); ok {
+				if v < 1 {
+					return mcp.NewToolResultError("invalid 'top': must be at least 1"), nil
+				}
+				top = int(v)
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			pg, err := pagingArgs(ctx, "prometheus_get_series", b, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if pg.cursor != "" {
+				page, err := pg.next(ctx, pages)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return mcp.NewToolResultText(formatPage(page)), nil
 			}
 
-			v1api := v1.NewAPI(client)
-			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
+			if match == "" {
+				return mcp.NewToolResultError("invalid 'match', expected a series selector"), nil
+			}
+			if err := b.Guard.CheckMatch(match); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 
-			lblSets, warnings, err := v1api.Series(ctx, []string{match}, time.Now().Add(-time.Hour), time.Now())
+			res, err := b.Series(ctx, []string{match}, time.Now().Add(-time.Hour), time.Now(), b.Guard.SeriesLimit())
 			if err != nil {
 				slog.Error("error querying Prometheus", "error", err)
 				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
 			}
-			if len(warnings) > 0 {
-				slog.Warn("Prometheus warnings", "warnings", warnings)
+			if err := b.Guard.CheckSeries(len(res.Value)); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
 			}
 
-			txt := "We have the following series:\n\n"
-
-			for _, lblSet := range lblSets {
-				txt += lblSet.String() + "\n"
+			var txt string
+			if pg.size > 0 {
+				txt = formatPage(pg.first(ctx, pages, "series", seriesLines(res.Value)))
+			} else {
+				txt = seriesWithinBudget(ctx, b, res.Value, output, top, func() string {
+					return pages.Snapshot(pg.scope, "series", seriesLines(res.Value))
+				})
+			}
+			if note := res.CacheNote(); note != "" {
+				txt += "\n" + note + "\n"
 			}
 
 			return mcp.NewToolResultText(txt), nil
 		}
 }
+
+// formatSeries lists series, grouping the series of histograms under their base
+// name, and adds hints on how to query the histograms found.
+func formatSeries(ctx context.Context, b *backend.Backend, series []model.LabelSet) string {
+	classic, rest := promql.GroupClassicHistograms(series)
+	native, rest := nativeHistograms(ctx, b, rest)
+
+	var sb strings.Builder
+	for _, h := range classic {
+		fmt.Fprintf(&sb, "%s is a classic histogram with %d buckets le=%s, and the following series of _bucket, _sum and _count:\n", h.Name, len(h.Buckets), h.BucketSummary())
+		for _, s := range h.Series {
+			sb.WriteString(s.String() + "\n")
+		}
+	}
+	for _, h := range native {
+		fmt.Fprintf(&sb, "%s is a native histogram, with the following series:\n", h.Name)
+		for _, s := range h.Series {
+			sb.WriteString(s.String() + "\n")
+		}
+	}
+	for _, s := range rest {
+		sb.WriteString(s.String() + "\n")
+	}
+
+	if len(classic) > 0 {
+		sb.WriteString("\n" + classicHistogramHint + "\n")
+	}
+	if len(native) > 0 {
+		sb.WriteString("\n" + nativeHistogramHint + "\n")
+	}
+	return sb.String()
+}
+
+// seriesLines returns series one per line, ordered by their labels.
+func seriesLines(series []model.LabelSet) []string {
+	lines := make([]string, 0, len(series))
+	for _, s := range series {
+		lines = append(lines, s.String())
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// seriesWithinBudget formats series in the requested output, degrading it from
+// every series to a summary by metric to only the metric names until it fits
+// the budget of the tool call, and noting what was dropped along with the
+// cursor returned by snapshot to page through every series instead.
+func seriesWithinBudget(ctx context.Context, b *backend.Backend, series []model.LabelSet, output string, top int, snapshot func() string) string {
+	bgt := budget.FromContext(ctx)
+
+	if output == seriesOutputFull {
+		txt := "We have the following series:\n\n" + formatSeries(ctx, b, series)
+		if bgt.Fits(txt) {
+			return txt
+		}
+	}
+
+	summaries := promql.Summarise(series, top)
+	txt := "We have the following series, summarised by metric:\n\n" + formatSummary(summaries)
+	if output == seriesOutputSummary && bgt.Fits(txt) {
+		return txt
+	}
+
+	// From here on series are dropped, so a snapshot of them is kept to be
+	// paged through instead.
+	more := fmt.Sprintf("To page through every series instead, call this tool again with the cursor argument set to %q.\n", snapshot())
+	if output == seriesOutputFull {
+		txt = fmt.Sprintf("The %d series exceed the response budget of %s, so they are summarised by metric instead, dropping their individual label sets.\n", len(series), bgt) + more + "\n" + txt
+		if bgt.Fits(txt) {
+			return txt
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The %d series exceed the response budget of %s even when summarised, so only the names of their %d metrics are listed, dropping their labels.\n", len(series), bgt, len(summaries))
+	sb.WriteString("Retry with more specific label matchers, e.g. a single metric name, to see their labels.\n")
+	sb.WriteString(more + "\n")
+	sb.WriteString("We have the following metrics:\n\n")
+	for _, m := range summaries {
+		fmt.Fprintf(&sb, "%s: %d series\n", m.Name, m.Series)
+	}
+	txt, _ = bgt.Truncate(sb.String())
+	return txt
+}
+
+func formatSummary(summaries []promql.MetricSummary) string {
+	var sb strings.Builder
+	for _, m := range summaries {
+		fmt.Fprintf(&sb, "%s: %d series\n", m.Name, m.Series)
+		for _, l := range m.Labels {
+			values := make([]string, 0, len(l.Top))
+			for _, v := range l.Top {
+				values = append(values, fmt.Sprintf("%s (%d)", v.Value, v.Count))
+			}
+			more := ""
+			if l.Values > len(l.Top) {
+				more = ", ..."
+			}
+			fmt.Fprintf(&sb, "  %s (%d values): %s%s\n", l.Name, l.Values, strings.Join(values, ", "), more)
+		}
+	}
+	return sb.String()
+}
+
+// nativeHistograms probes the metrics of series that could be native
+// histograms, and groups the series of those that are under their name. Probes
+// are only sent to backends known to support native histograms, and are
+// subject to the same checks as any other query.
+func nativeHistograms(ctx context.Context, b *backend.Backend, series []model.LabelSet) ([]promql.Histogram, []model.LabelSet) {
+	if env := b.Environment(); env == nil || env.Capabilities == nil || env.Capabilities.Support["native_histograms"] != environment.Supported {
+		return nil, series
+	}
+
+	var candidates []string
+	for _, s := range series {
+		name := string(s[model.MetricNameLabel])
+		if name == "" || slices.Contains(candidates, name) || hasAnySuffix(name, "_total", "_created", "_info", promql.BucketSuffix, promql.SumSuffix, promql.CountSuffix) {
+			continue
+		}
+		candidates = append(candidates, name)
+		if len(candidates) == maxNativeHistogramProbes {
+			break
+		}
+	}
+
+	byName := map[string]*promql.Histogram{}
+	now := time.Now()
+	for _, name := range candidates {
+		if res := checkQuery(ctx, b, backend.NativeHistogramQuery(name), now, now, 0); res != nil {
+			slog.Debug("skipping native histogram probe rejected by the limits", "metric", name)
+			continue
+		}
+		res, err := b.NativeHistogram(ctx, name)
+		if err != nil {
+			slog.Debug("error probing for native histogram", "metric", name, "error", err)
+			continue
+		}
+		if res.Value {
+			byName[name] = &promql.Histogram{Name: name}
+		}
+	}
+	if len(byName) == 0 {
+		return nil, series
+	}
+
+	var rest []model.LabelSet
+	for _, s := range series {
+		h, ok := byName[string(s[model.MetricNameLabel])]
+		if !ok {
+			rest = append(rest, s)
+			continue
+		}
+		lbls := s.Clone()
+		delete(lbls, model.MetricNameLabel)
+		h.Series = append(h.Series, lbls)
+	}
+
+	histograms := make([]promql.Histogram, 0, len(byName))
+	for _, name := range candidates {
+		if h, ok := byName[name]; ok {
+			histograms = append(histograms, *h)
+		}
+	}
+	return histograms, rest
+}
+
+func hasAnySuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
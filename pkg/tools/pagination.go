@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/budget"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
+)
+
+// withPaginationArguments adds the arguments to page through large results.
+func withPaginationArguments() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithString("cursor",
+			mcp.Description("The cursor of the page to get, as returned by a previous call to this tool. The other arguments of the call, except datasource and tenant, are ignored, as pages are served from a snapshot of the result of the first call."))(t)
+		mcp.WithNumber("page_size",
+			mcp.Description("The maximum number of items per page. Pages are always cut short to fit the response budget."))(t)
+	}
+}
+
+// paging is how a tool call pages through its result.
+type paging struct {
+	scope  string
+	cursor string
+	size   int
+}
+
+// pagingArgs returns the paging requested by the arguments of a call to tool
+// against b.
+func pagingArgs(ctx context.Context, tool string, b *backend.Backend, args map[string]any) (paging, error) {
+	p := paging{scope: strings.Join([]string{tool, b.Name, b.Tenant(ctx)}, "\x00")}
+	p.cursor, _ = args["cursor"].(string)
+	if v, ok := args["page_size"].(float64); ok {
+		if v < 1 {
+			return paging{}, errors.New("invalid 'page_size': must be at least 1")
+		}
+		p.size = int(v)
+	}
+	return p, nil
+}
+
+// next returns the page at the cursor of the call.
+func (p paging) next(ctx context.Context, pages *pagination.Store) (pagination.Page, error) {
+	return pages.Next(p.scope, p.cursor, p.size, budget.FromContext(ctx))
+}
+
+// first returns the first page of items, described by what.
+func (p paging) first(ctx context.Context, pages *pagination.Store, what string, items []string) pagination.Page {
+	return pages.First(p.scope, what, items, p.size, budget.FromContext(ctx))
+}
+
+// formatPage lists the items of a page and how to get the next page.
+func formatPage(page pagination.Page) string {
+	var sb strings.Builder
+	if page.Offset == 0 && page.Next == "" {
+		fmt.Fprintf(&sb, "We have the following %s:\n\n", page.What)
+	} else {
+		fmt.Fprintf(&sb, "We have the following %s (%d-%d of %d):\n\n", page.What, page.Offset+1, page.Offset+len(page.Items), page.Total)
+	}
+	for _, item := range page.Items {
+		sb.WriteString(item + "\n")
+	}
+	if page.Next != "" {
+		fmt.Fprintf(&sb, "\nThere are more %s, call this tool again with the cursor argument set to %q to get the next page.\n", page.What, page.Next)
+	}
+	return sb.String()
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/cost"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+const (
+	QueryToolDescription = `Allows you to evaluate a PromQL expression at the current time by querying the api/v1/query endpoint.
+An example output of this tool would be like the following,
+
+{job="api", namespace="default"} => 0.25 @[1704103200]
+{job="db", namespace="default"} => 0.01 @[1704103200]
+...
+
+The cost of the query is estimated before it is run, and queries that would touch too many series or samples are rejected.
+Prefer aggregations like sum by (...) over raw selectors, so that the result stays small.`
+
+	QueryRangeToolDescription = `Allows you to evaluate a PromQL expression over a range of time ending now by querying the api/v1/query_range endpoint.
+An example output of this tool would be like the following,
+
+{job="api", namespace="default"} =>
+0.25 @[1704103200]
+0.27 @[1704103260]
+...
+
+The cost of the query is estimated before it is run, and queries that would touch too many series or samples are rejected.
+Prefer aggregations like sum by (...) over raw selectors and the largest step that answers the question, so that the result stays small.`
+)
+
+func Query(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_query",
+			mcp.WithDescription(QueryToolDescription),
+			mcp.WithString("query", mcp.Required(),
+				mcp.Description("The PromQL expression to evaluate.")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			query, ok := args["query"].(string)
+			if !ok {
+				return mcp.NewToolResultError("invalid type for 'query', expected string"), nil
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			now := time.Now()
+			if res := checkQuery(ctx, b, query, now, now, 0); res != nil {
+				return res, nil
+			}
+
+			value, warnings, err := v1.NewAPI(b.Client).Query(ctx, query, now)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+			if len(warnings) > 0 {
+				slog.Warn("Prometheus warnings", "warnings", warnings)
+			}
+
+			return queryResult(b, value), nil
+		}
+}
+
+func QueryRange(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_query_range",
+			mcp.WithDescription(QueryRangeToolDescription),
+			mcp.WithString("query", mcp.Required(),
+				mcp.Description("The PromQL expression to evaluate.")),
+			mcp.WithString("range", mcp.Required(),
+				mcp.Description("The time range to evaluate the expression over, ending now, as a Prometheus duration, e.g. 1h.")),
+			mcp.WithString("step",
+				mcp.Description("The step between evaluations, as a Prometheus duration, e.g. 1m. Defaults to 1m.")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			query, ok := args["query"].(string)
+			if !ok {
+				return mcp.NewToolResultError("invalid type for 'query', expected string"), nil
+			}
+			queryRange, err := durationArg(args, "range", 0)
+			if err != nil {
+				return mcp.NewToolResultError("invalid 'range': " + err.Error()), nil
+			}
+			if queryRange <= 0 {
+				return mcp.NewToolResultError("invalid 'range': must be greater than zero"), nil
+			}
+			step, err := durationArg(args, "step", time.Minute)
+			if err != nil {
+				return mcp.NewToolResultError("invalid 'step': " + err.Error()), nil
+			}
+			if step <= 0 {
+				return mcp.NewToolResultError("invalid 'step': must be greater than zero"), nil
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			end := time.Now()
+			start := end.Add(-queryRange)
+			if err := b.Guard.CheckRange(start, end); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := b.Guard.CheckStep(step); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if res := checkQuery(ctx, b, query, start, end, step); res != nil {
+				return res, nil
+			}
+
+			value, warnings, err := v1.NewAPI(b.Client).QueryRange(ctx, query, v1.Range{Start: start, End: end, Step: step})
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+			if len(warnings) > 0 {
+				slog.Warn("Prometheus warnings", "warnings", warnings)
+			}
+
+			return queryResult(b, value), nil
+		}
+}
+
+// checkQuery checks a query against the limits of the backend and estimates its
+// cost, returning an error result if it must not be run.
+func checkQuery(ctx context.Context, b *backend.Backend, query string, start, end time.Time, step time.Duration) *mcp.CallToolResult {
+	selectors, err := promql.Selectors(query)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	if err := b.Guard.CheckSelectors(selectors); err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	if err := b.Estimator.Check(ctx, query, start, end, step); err != nil {
+		var limitErr *cost.LimitError
+		if !errors.As(err, &limitErr) {
+			slog.Error("error estimating query cost", "error", err)
+			return mcp.NewToolResultError("error estimating query cost: " + err.Error())
+		}
+		return mcp.NewToolResultError(err.Error())
+	}
+	return nil
+}
+
+func queryResult(b *backend.Backend, value model.Value) *mcp.CallToolResult {
+	n := 0
+	switch v := value.(type) {
+	case model.Vector:
+		n = len(v)
+	case model.Matrix:
+		n = len(v)
+	}
+	if err := b.Guard.CheckSeries(n); err != nil {
+		return mcp.NewToolResultError("the query returned too many series: " + err.Error())
+	}
+
+	if n == 0 && (value.Type() == model.ValVector || value.Type() == model.ValMatrix) {
+		return mcp.NewToolResultText("The query returned no data.")
+	}
+	return mcp.NewToolResultText(value.String())
+}
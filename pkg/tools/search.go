@@ -0,0 +1,207 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+	"github.com/saswatamcode/promql-mcp/pkg/search"
+)
+
+const (
+	SearchMetricsToolDescription = `Searches the metrics of Prometheus by what they measure, e.g. "disk latency" or "memory used by containers",
+matching the words of the query against the names of the metrics, from the api/v1/label/__name__/values endpoint, and their help texts,
+from the api/v1/metadata endpoint. Words match exactly, as prefixes, e.g. "req" for "requests", or fuzzily, e.g. "latncy" for "latency",
+and matches in names rank above matches in help texts. If semantic search is enabled, metrics are also ranked by how close their name and
+help text are in meaning to the query, so that e.g. "memory" finds container_memory_rss and "latency" finds metrics named after durations.
+An example output of this tool would be like the following,
+
+We have the following metrics matching "disk latency", best first:
+
+node_disk_read_time_seconds_total (counter): The total number of seconds spent by all reads. (score 0.62)
+node_disk_write_time_seconds_total (counter): This is the total number of seconds spent by all writes. (score 0.62)
+http_request_duration_seconds (histogram): Latency of HTTP requests. - classic histogram exposed as http_request_duration_seconds_bucket, _sum and _count (score 0.21)
+...
+
+Use this tool to find the right metric to answer a question, instead of trying regular expressions against __name__ with prometheus_get_series,
+and then check its labels with prometheus_get_series or the prometheus://<datasource>/metric/{name} resource.`
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+func SearchMetrics(backends *backend.Set, semantic *search.Semantic) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_search_metrics",
+			mcp.WithDescription(SearchMetricsToolDescription),
+			mcp.WithString("query", mcp.Required(),
+				mcp.Description("What the metric measures, in a few words, e.g. disk latency.")),
+			mcp.WithNumber("limit",
+				mcp.Description("The maximum number of metrics to return. Defaults to 10, at most 50.")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			query, ok := args["query"].(string)
+			if !ok || strings.TrimSpace(query) == "" {
+				return mcp.NewToolResultError("invalid 'query', expected the words to search for"), nil
+			}
+			limit := defaultSearchLimit
+			if v, ok := args["limit"].(float64); ok {
+				if v < 1 || v > maxSearchLimit {
+					return mcp.NewToolResultError(fmt.Sprintf("invalid 'limit': must be between 1 and %d", maxSearchLimit)), nil
+				}
+				limit = int(v)
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			end := time.Now()
+			names, err := b.LabelValues(ctx, model.MetricNameLabel, nil, end.Add(-labelValuesWindow), end, b.Guard.SeriesLimit())
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+			var truncated bool
+			names.Value, truncated = b.TruncateValues(names.Value)
+			metadata, err := b.Metadata(ctx, "", "")
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+
+			docs := metricDocuments(names.Value, metadata.Value)
+			idx := search.New(docs)
+			matches := idx.Search(query, limit)
+			var indexing *search.IndexingError
+			if semantic != nil {
+				key := b.Name
+				tenant := b.Tenant(ctx)
+				if tenant != "" {
+					key += "/" + tenant
+				}
+				// Only the vectors of the configured tenant are persisted, as
+				// callers may select any tenant.
+				similarity, err := semantic.Scores(ctx, key, tenant == b.DefaultTenant(), docs, query)
+				switch {
+				case errors.As(err, &indexing):
+				case err != nil:
+					// Fall back to the lexical matches rather than failing
+					// the search.
+					slog.Warn("error scoring metrics semantically", "error", err)
+				default:
+					matches = idx.Rank(query, limit, similarity, semantic.Weight())
+				}
+			}
+			var cut string
+			if truncated {
+				cut = fmt.Sprintf("The datasource has more than the limit of %d metrics, so only some of them were searched, use prometheus_get_metric_names to page through all of them.", b.Guard.Limits().MaxSeries)
+			}
+			if len(matches) == 0 {
+				text := fmt.Sprintf("There are no metrics matching %q, try other words, e.g. synonyms or the name of the exporter.", query)
+				if cut != "" {
+					text += "\n\n" + cut
+				}
+				return mcp.NewToolResultText(text), nil
+			}
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "We have the following metrics matching %q, best first:\n\n", query)
+			for _, m := range matches {
+				sb.WriteString(formatMatch(m) + "\n")
+			}
+			if indexing != nil {
+				fmt.Fprintf(&sb, "\nMetrics are only ranked by the words of their names and help texts, as %s. Search again later to also rank them by meaning.\n", indexing)
+			}
+			if cut != "" {
+				sb.WriteString("\n" + cut + "\n")
+			}
+			if note := names.CacheNote(); note != "" {
+				sb.WriteString("\n" + note + "\n")
+			}
+
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
+
+// classicHistogramType is the type of the documents of classic histograms,
+// which are indexed once under their base name.
+const classicHistogramType = "classic histogram"
+
+// metricDocuments returns the documents to search for the metrics names, with
+// their metadata. The _bucket, _sum and _count series of classic histograms
+// are indexed once, under their base name.
+func metricDocuments(names model.LabelValues, metadata map[string][]v1.Metadata) []search.Document {
+	exists := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		exists[string(n)] = struct{}{}
+	}
+
+	docs := make([]search.Document, 0, len(names))
+	for _, n := range names {
+		name := string(n)
+		typ := ""
+		if base, ok := strings.CutSuffix(name, promql.BucketSuffix); ok {
+			if _, ok := exists[base+promql.CountSuffix]; ok {
+				name, typ = base, classicHistogramType
+			}
+		} else if base, ok := cutAnySuffix(name, promql.SumSuffix, promql.CountSuffix); ok {
+			if _, ok := exists[base+promql.BucketSuffix]; ok {
+				continue
+			}
+		}
+
+		d := search.Document{Name: name, Type: typ}
+		if mds := metadata[name]; len(mds) > 0 {
+			d.Help, d.Unit = mds[0].Help, mds[0].Unit
+			if d.Type == "" {
+				d.Type = string(mds[0].Type)
+			}
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+func cutAnySuffix(s string, suffixes ...string) (string, bool) {
+	for _, suffix := range suffixes {
+		if base, ok := strings.CutSuffix(s, suffix); ok {
+			return base, true
+		}
+	}
+	return s, false
+}
+
+func formatMatch(m search.Match) string {
+	var sb strings.Builder
+	sb.WriteString(m.Name)
+	typ := m.Type
+	if typ == classicHistogramType {
+		typ = string(v1.MetricTypeHistogram)
+	}
+	if typ != "" {
+		sb.WriteString(" (" + typ + ")")
+	}
+	if m.Unit != "" {
+		sb.WriteString(" [" + m.Unit + "]")
+	}
+	if m.Help != "" {
+		sb.WriteString(": " + m.Help)
+	}
+	if m.Type == classicHistogramType {
+		sb.WriteString(" - classic histogram exposed as " + m.Name + promql.BucketSuffix + ", _sum and _count")
+	}
+	fmt.Fprintf(&sb, " (score %.2f)", m.Score)
+	return sb.String()
+}
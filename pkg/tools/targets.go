@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/pagination"
+)
+
+const (
+	GetTargetsToolDescription = `Allows you to get the active scrape targets of Prometheus and their health by querying the api/v1/targets endpoint.
+An example output of this tool would be like the following,
+
+We have the following targets:
+
+down: {instance="10.0.0.1:8080", job="api", namespace="default"} last scraped 2024-01-01T10:00:00Z: connection refused
+up: {instance="10.0.0.2:8080", job="api", namespace="default"} last scraped 2024-01-01T10:00:01Z
+...
+
+Large results are split into pages, listing the next cursor at the end, to be passed back in the cursor argument to get the next page.
+
+Use this tool to check whether the targets exposing the metrics you are interested in are actually being scraped.`
+)
+
+func GetTargets(backends *backend.Set, pages *pagination.Store) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("prometheus_get_targets",
+			mcp.WithDescription(GetTargetsToolDescription),
+			mcp.WithString("job",
+				mcp.Description("Only return targets with this job label.")),
+			mcp.WithString("health",
+				mcp.Description("Only return targets with this health."),
+				mcp.Enum(string(v1.HealthGood), string(v1.HealthBad), string(v1.HealthUnknown))),
+			withDatasourceArguments(),
+			withPaginationArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			job, _ := args["job"].(string)
+			health, _ := args["health"].(string)
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			pg, err := pagingArgs(ctx, "prometheus_get_targets", b, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if pg.cursor != "" {
+				page, err := pg.next(ctx, pages)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return mcp.NewToolResultText(formatPage(page)), nil
+			}
+
+			res, err := v1.NewAPI(b.Client).Targets(ctx)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+
+			targets := slices.DeleteFunc(res.Active, func(t v1.ActiveTarget) bool {
+				return (job != "" && string(t.Labels["job"]) != job) ||
+					(health != "" && string(t.Health) != health)
+			})
+			if len(targets) == 0 {
+				return mcp.NewToolResultText("There are no matching targets."), nil
+			}
+			slices.SortFunc(targets, func(a, b v1.ActiveTarget) int {
+				return strings.Compare(a.Labels.String(), b.Labels.String())
+			})
+
+			lines := make([]string, 0, len(targets))
+			for _, t := range targets {
+				line := fmt.Sprintf("%s: %s last scraped %s", t.Health, t.Labels, t.LastScrape.Format(time.RFC3339))
+				if t.LastError != "" {
+					line += ": " + t.LastError
+				}
+				lines = append(lines, line)
+			}
+
+			return mcp.NewToolResultText(formatPage(pg.first(ctx, pages, "targets", lines))), nil
+		}
+}
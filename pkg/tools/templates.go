@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+	"github.com/saswatamcode/promql-mcp/pkg/templates"
+)
+
+const (
+	ListTemplatesToolDescription = `Lists the curated library of vetted PromQL query templates, such as histogram quantiles, error ratios and
+saturation queries, along with their typed parameters. Templates can be filled in with promql_render_template.
+
+An example output of this tool would be like the following,
+
+We have the following query templates:
+
+error_ratio: The ratio of failed requests to all requests, between 0 and 1.
+  - metric (metric, required): The counter of requests, e.g. http_requests_total.
+  - error_matchers (matchers, default code=~"5.."): Label matchers selecting only the failed requests.
+  - window (duration, default 5m): The window to compute the rates over.
+
+Always check this library before writing a query from scratch, as templates encode best practices that are easy to get wrong.`
+
+	RenderTemplateToolDescription = `Renders a query template from the curated library with the given parameters.
+Every parameter value is checked against its type, the resulting query is validated with the PromQL parser and
+every metric it references is checked to exist in Prometheus over the last 1h.
+
+An example output of this tool would be like the following,
+
+histogram_quantile(0.99, sum by (le, job) (rate(http_request_duration_seconds_bucket{job="api"}[5m])))
+
+All referenced metrics exist.
+
+Use promql_list_templates to find the names and parameters of the available templates.`
+)
+
+func ListTemplates(library *templates.Library) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("promql_list_templates",
+			mcp.WithDescription(ListTemplatesToolDescription),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var sb strings.Builder
+			sb.WriteString("We have the following query templates:\n\n")
+			for _, t := range library.List() {
+				fmt.Fprintf(&sb, "%s: %s\n", t.Name, t.Description)
+				for _, p := range t.Parameters {
+					dflt := "required"
+					if p.Default != nil {
+						dflt = "default " + *p.Default
+						if *p.Default == "" {
+							dflt = "optional"
+						}
+					}
+					fmt.Fprintf(&sb, "  - %s (%s, %s): %s\n", p.Name, p.Type, dflt, p.Description)
+				}
+				sb.WriteString("\n")
+			}
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
+
+func RenderTemplate(backends *backend.Set, library *templates.Library) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("promql_render_template",
+			mcp.WithDescription(RenderTemplateToolDescription),
+			mcp.WithString("name", mcp.Required(),
+				mcp.Description("The name of the query template to render.")),
+			mcp.WithObject("parameters",
+				mcp.Description(`The values of the parameters of the template, keyed by parameter name, e.g. {"metric": "http_requests_total", "by": "job"}. Parameters with defaults can be omitted.`)),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			name, ok := args["name"].(string)
+			if !ok {
+				return mcp.NewToolResultError("invalid type for 'name', expected string"), nil
+			}
+			values := map[string]string{}
+			if params, ok := args["parameters"]; ok && params != nil {
+				m, ok := params.(map[string]any)
+				if !ok {
+					return mcp.NewToolResultError("invalid type for 'parameters', expected object"), nil
+				}
+				for k, v := range m {
+					values[k] = fmt.Sprint(v)
+				}
+			}
+
+			t, err := library.Get(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			query, err := t.Render(values)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			missing, closest, truncated, err := missingMetrics(ctx, b, query)
+			if err != nil {
+				slog.Error("error querying Prometheus", "error", err)
+				return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+			}
+
+			var sb strings.Builder
+			sb.WriteString(query + "\n\n")
+			if len(missing) == 0 {
+				sb.WriteString("All referenced metrics exist.")
+				return mcp.NewToolResultText(sb.String()), nil
+			}
+			sb.WriteString("The query references metrics that do not exist in the last 1h:\n")
+			for _, m := range missing {
+				fmt.Fprintf(&sb, "- %s", m)
+				if c := closest[m]; len(c) > 0 {
+					sb.WriteString(", closest metric names: " + strings.Join(c, ", "))
+				}
+				sb.WriteString("\n")
+			}
+			if truncated {
+				fmt.Fprintf(&sb, "The datasource has more than the limit of %d metrics, so the closest names are only picked from some of them, use prometheus_search_metrics to find others.\n", b.Guard.Limits().MaxSeries)
+			}
+			sb.WriteString("Render the template again with the right metric names.")
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
+
+// missingMetrics returns the metric names referenced by query that have no
+// series over the last hour, along with the closest existing names for each.
+// The closest names are only picked from some of the metric names if there
+// are more than the series limit, which is returned as well.
+func missingMetrics(ctx context.Context, b *backend.Backend, query string) ([]string, map[string][]string, bool, error) {
+	selectors, err := promql.Selectors(query)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	end := time.Now()
+	start := end.Add(-defaultVerifyWindow)
+	res, err := b.LabelValues(ctx, labels.MetricName, nil, start, end, b.Guard.SeriesLimit())
+	if err != nil {
+		return nil, nil, false, err
+	}
+	names, truncated := b.TruncateValues(res.Value)
+
+	var missing []string
+	closest := map[string][]string{}
+	for _, s := range promql.Unique(selectors) {
+		if s.Name == "" || slices.Contains(missing, s.Name) || slices.Contains(names, model.LabelValue(s.Name)) {
+			continue
+		}
+		if truncated {
+			exists, err := anySeries(ctx, b, labels.MetricName, fmt.Sprintf("{%s=%q}", labels.MetricName, s.Name), start, end)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if exists {
+				continue
+			}
+		}
+		missing = append(missing, s.Name)
+		closest[s.Name] = promql.Closest(s.Name, labelValueStrings(names), maxSuggestions)
+	}
+	return missing, closest, truncated, nil
+}
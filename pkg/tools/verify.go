@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/saswatamcode/promql-mcp/pkg/backend"
+	"github.com/saswatamcode/promql-mcp/pkg/promql"
+)
+
+const (
+	VerifySelectorsToolDescription = `Verifies that every vector selector in a PromQL expression actually matches series in Prometheus.
+Each selector is extracted from the expression and sent as a match[] arg to the api/v1/series endpoint over the given window.
+Selectors that match zero series are reported along with the closest existing metric names and label values, so that typos
+and non-existent labels can be fixed before the query is handed to the user. Functions that the datasource is known not to support
+are reported as well.
+
+An example output of this tool would be like the following,
+
+Checked 2 selector(s) over the last 1h:
+
+OK: http_requests_total{job="api"} matches 4 series
+NO MATCH: http_request_duration_seconds_bucket{job="apis"}
+  - label "job" has no value "apis" on this metric, closest values: api
+UNSUPPORTED: limitk is not supported by the datasource prometheus, see prometheus_capabilities
+
+Always use this tool on a query you have generated before presenting it to the user.`
+
+	defaultVerifyWindow = time.Hour
+	maxSuggestions      = 5
+)
+
+func VerifySelectors(backends *backend.Set) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool("promql_verify_selectors",
+			mcp.WithDescription(VerifySelectorsToolDescription),
+			mcp.WithString("query", mcp.Required(),
+				mcp.Description("The PromQL expression whose selectors should be verified.")),
+			mcp.WithString("window",
+				mcp.Description("How far back to look for matching series, as a Prometheus duration, e.g. 1h or 30m. Defaults to 1h.")),
+			withDatasourceArguments(),
+			withBudgetArguments()),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := request.GetArguments()
+			query, ok := args["query"].(string)
+			if !ok {
+				return mcp.NewToolResultError("invalid type for 'query', expected string"), nil
+			}
+			window, err := durationArg(args, "window", defaultVerifyWindow)
+			if err != nil {
+				return mcp.NewToolResultError("invalid 'window': " + err.Error()), nil
+			}
+
+			ctx, b, err := datasource(ctx, backends, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			selectors, err := promql.Selectors(query)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			unsupported, err := unsupportedFunctions(b, query)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if len(selectors) == 0 && len(unsupported) == 0 {
+				return mcp.NewToolResultText("The expression does not contain any vector selectors, there is nothing to verify."), nil
+			}
+			selectors = promql.Unique(selectors)
+
+			end := time.Now()
+			start := end.Add(-window)
+			if err := b.Guard.CheckRange(start, end); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := b.Guard.CheckSelectors(selectors); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "Checked %d selector(s) over the last %s:\n\n", len(selectors), model.Duration(window))
+
+			for _, s := range selectors {
+				res, err := b.Series(ctx, []string{s.Match()}, start, end, b.Guard.SeriesLimit())
+				if err != nil {
+					slog.Error("error querying Prometheus", "error", err)
+					return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+				}
+				lblSets := res.Value
+
+				if len(lblSets) > 0 {
+					if b.Guard.CheckSeries(len(lblSets)) != nil {
+						fmt.Fprintf(&sb, "OK: %s matches more than %d series\n", s, len(lblSets)-1)
+						continue
+					}
+					fmt.Fprintf(&sb, "OK: %s matches %d series\n", s, len(lblSets))
+					continue
+				}
+
+				fmt.Fprintf(&sb, "NO MATCH: %s\n", s)
+				hints, err := explainNoMatch(ctx, b, s, start, end)
+				if err != nil {
+					slog.Error("error querying Prometheus", "error", err)
+					return mcp.NewToolResultError("error querying Prometheus: " + err.Error()), err
+				}
+				for _, h := range hints {
+					sb.WriteString("  - " + h + "\n")
+				}
+			}
+			for _, f := range unsupported {
+				fmt.Fprintf(&sb, "UNSUPPORTED: %s is not supported by the datasource %s, see prometheus_capabilities\n", f, b.Name)
+			}
+
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+}
+
+// explainNoMatch works out which part of a selector that matched nothing is
+// wrong, by checking the metric name and every matcher against the label values
+// that actually exist.
+func explainNoMatch(ctx context.Context, b *backend.Backend, s promql.Selector, start, end time.Time) ([]string, error) {
+	var hints []string
+
+	var scope []string
+	subject := "any series"
+	if s.Name != "" {
+		res, err := b.LabelValues(ctx, labels.MetricName, nil, start, end, b.Guard.SeriesLimit())
+		if err != nil {
+			return nil, err
+		}
+		names, truncated := b.TruncateValues(res.Value)
+		exists := slices.Contains(names, model.LabelValue(s.Name))
+		if !exists && truncated {
+			exists, err = anySeries(ctx, b, labels.MetricName, fmt.Sprintf("{%s=%q}", labels.MetricName, s.Name), start, end)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !exists {
+			hint := fmt.Sprintf("metric %q does not exist", s.Name)
+			if closest := promql.Closest(s.Name, labelValueStrings(names), maxSuggestions); len(closest) > 0 {
+				hint += ", closest metric names: " + strings.Join(closest, ", ")
+				if truncated {
+					hint += fmt.Sprintf(" (picked from only %d of the metric names, as there are more)", len(names))
+				}
+			}
+			return append(hints, hint), nil
+		}
+		scope = []string{fmt.Sprintf("{%s=%q}", labels.MetricName, s.Name)}
+		subject = "this metric"
+	}
+
+	for _, m := range s.Matchers {
+		if m.Name == labels.MetricName {
+			continue
+		}
+
+		res, err := b.LabelValues(ctx, m.Name, scope, start, end, b.Guard.SeriesLimit())
+		if err != nil {
+			return nil, err
+		}
+		values, truncated := b.TruncateValues(res.Value)
+		if slices.ContainsFunc(values, func(v model.LabelValue) bool { return m.Matches(string(v)) }) {
+			continue
+		}
+		if truncated {
+			// The value may be past the cut, so look for it directly.
+			if m.Matches("") {
+				hints = append(hints, fmt.Sprintf("label %q has more than %d values on %s, none of the first %d of which matches %s", m.Name, len(values), subject, len(values), m))
+				continue
+			}
+			selector := "{" + m.String() + "}"
+			if s.Name != "" {
+				selector = fmt.Sprintf("{%s=%q, %s}", labels.MetricName, s.Name, m)
+			}
+			found, err := anySeries(ctx, b, m.Name, selector, start, end)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				continue
+			}
+		}
+		if len(values) == 0 {
+			// Series without the label have it set to the empty string.
+			if !m.Matches("") {
+				hints = append(hints, fmt.Sprintf("label %q does not exist on %s", m.Name, subject))
+			}
+			continue
+		}
+		if m.Matches("") {
+			hints = append(hints, fmt.Sprintf("matcher %s only matches series without the label %q, which may not exist on %s", m, m.Name, subject))
+			continue
+		}
+
+		var hint string
+		switch m.Type {
+		case labels.MatchEqual:
+			hint = fmt.Sprintf("label %q has no value %q on %s", m.Name, m.Value, subject)
+		case labels.MatchRegexp:
+			hint = fmt.Sprintf("no value of label %q on %s matches %s", m.Name, subject, m)
+		default:
+			hints = append(hints, fmt.Sprintf("every value of label %q on %s is excluded by %s", m.Name, subject, m))
+			continue
+		}
+		if closest := promql.Closest(m.Value, labelValueStrings(values), maxSuggestions); len(closest) > 0 {
+			hint += ", closest values: " + strings.Join(closest, ", ")
+			if truncated {
+				hint += fmt.Sprintf(" (picked from only %d of the values, as there are more)", len(values))
+			}
+		}
+		hints = append(hints, hint)
+	}
+
+	if len(hints) == 0 {
+		hints = append(hints, "every matcher exists on its own, but no single series matches all of them together")
+	}
+	return hints, nil
+}
+
+// anySeries reports whether any series between start and end matches
+// selector, for when the values it was looked for in were cut at the series
+// limit.
+func anySeries(ctx context.Context, b *backend.Backend, label, selector string, start, end time.Time) (bool, error) {
+	res, err := b.LabelValues(ctx, label, []string{selector}, start, end, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(res.Value) > 0, nil
+}
+
+// unsupportedFunctions returns the functions in query that the backend is known
+// not to support, according to its last probed capabilities.
+func unsupportedFunctions(b *backend.Backend, query string) ([]string, error) {
+	env := b.Environment()
+	if env == nil || env.Capabilities == nil {
+		return nil, nil
+	}
+	functions, err := promql.Functions(query)
+	if err != nil {
+		return nil, err
+	}
+	return env.Capabilities.Unsupported(functions), nil
+}
+
+func labelValueStrings(values model.LabelValues) []string {
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		res = append(res, string(v))
+	}
+	return res
+}
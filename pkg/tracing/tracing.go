@@ -0,0 +1,278 @@
+// Package tracing traces MCP requests, tool calls and the requests made against
+// backends with OpenTelemetry, propagating the trace context to backends so that
+// traces join up with their own.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// DefaultConfig is the tracing configuration used if none is configured, with
+// tracing disabled.
+var DefaultConfig = Config{SamplingRatio: 1}
+
+// Config configures tracing.
+type Config struct {
+	// Exporter is otlp to send spans to an OTLP collector over HTTP, stdout or
+	// file to write them as JSON, e.g. for testing without a collector, or
+	// empty to disable tracing.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the URL of the OTLP traces endpoint, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+	// File is the file spans are appended to by the file exporter.
+	File string `yaml:"file"`
+	// SamplingRatio is the ratio of traces that are sampled, between 0 and 1.
+	SamplingRatio float64 `yaml:"sampling_ratio"`
+}
+
+// Tracer creates the spans of the server. A Tracer created from a
+// configuration that disables tracing creates no spans.
+type Tracer struct {
+	provider   trace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	shutdown   func(ctx context.Context) error
+}
+
+// New returns the tracer configured by cfg, for the service with the given
+// name and version.
+func New(ctx context.Context, cfg Config, name, version string) (*Tracer, error) {
+	t := &Tracer{
+		propagator: propagation.TraceContext{},
+		shutdown:   func(context.Context) error { return nil },
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone:
+		t.provider = noop.NewTracerProvider()
+		t.tracer = t.provider.Tracer(name)
+		return t, nil
+	case ExporterOTLP:
+		if cfg.Endpoint == "" {
+			return nil, errors.New("the otlp exporter requires an endpoint")
+		}
+		var err error
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint), otlptracehttp.WithHeaders(cfg.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+	case ExporterStdout:
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("creating stdout exporter: %w", err)
+		}
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, errors.New("the file exporter requires a file")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening traces file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("creating file exporter: %w", err)
+		}
+		exporter = &closingExporter{SpanExporter: exporter, f: f}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s or %s", cfg.Exporter, ExporterOTLP, ExporterStdout, ExporterFile)
+	}
+	if cfg.SamplingRatio < 0 || cfg.SamplingRatio > 1 {
+		return nil, fmt.Errorf("sampling ratio %v is not between 0 and 1", cfg.SamplingRatio)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", name),
+		attribute.String("service.version", version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+	)
+	t.provider = provider
+	t.tracer = provider.Tracer(name)
+	t.shutdown = provider.Shutdown
+	return t, nil
+}
+
+// closingExporter closes the file spans are written to on shutdown.
+type closingExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e *closingExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.f.Close())
+}
+
+// Shutdown exports the remaining spans and stops the tracer.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// Handler wraps an HTTP handler of a transport, creating a span for every
+// request that starts a new trace, linked to the span of the caller if it sent
+// a trace context. Callers aren't authenticated yet, so they neither pick the
+// trace ID that sampling is decided by, nor send baggage on to backends.
+func (t *Tracer) Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "mcp",
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithPublicEndpoint(),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
+
+// Register adds hooks to hooks, which must be passed to the MCP server, that
+// annotate the span of every HTTP request with the MCP request it carries.
+func (t *Tracer) Register(hooks *server.Hooks) {
+	hooks.AddBeforeAny(func(ctx context.Context, id any, method mcp.MCPMethod, _ any) {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("mcp.method.name", string(method)), attribute.String("jsonrpc.request.id", fmt.Sprint(id)))
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			span.SetAttributes(attribute.String("mcp.session.id", session.SessionID()))
+		}
+	})
+	hooks.AddOnError(func(ctx context.Context, _ any, _ mcp.MCPMethod, _ any, err error) {
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	})
+}
+
+// ToolMiddleware returns a tool handler middleware creating a span for every
+// tool call.
+func (t *Tracer) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx, span := t.start(ctx, string(mcp.MethodToolsCall), request.Params.Name, attribute.String("gen_ai.tool.name", request.Params.Name))
+			defer span.End()
+			if ds, ok := request.GetArguments()["datasource"].(string); ok && ds != "" {
+				span.SetAttributes(attribute.String("promql_mcp.datasource", ds))
+			}
+
+			res, err := next(ctx, request)
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case res != nil && res.IsError:
+				span.SetStatus(codes.Error, resultText(res))
+			}
+			return res, err
+		}
+	}
+}
+
+// PromptMiddleware returns a prompt handler middleware creating a span for
+// every prompt request.
+func (t *Tracer) PromptMiddleware() server.PromptHandlerMiddleware {
+	return func(next server.PromptHandlerFunc) server.PromptHandlerFunc {
+		return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			ctx, span := t.start(ctx, string(mcp.MethodPromptsGet), request.Params.Name, attribute.String("gen_ai.prompt.name", request.Params.Name))
+			defer span.End()
+
+			res, err := next(ctx, request)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return res, err
+		}
+	}
+}
+
+// ResourceMiddleware returns a resource handler middleware creating a span for
+// every resource read.
+func (t *Tracer) ResourceMiddleware() server.ResourceHandlerMiddleware {
+	return func(next server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+		return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			ctx, span := t.start(ctx, string(mcp.MethodResourcesRead), request.Params.URI, attribute.String("mcp.resource.uri", request.Params.URI))
+			defer span.End()
+
+			res, err := next(ctx, request)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return res, err
+		}
+	}
+}
+
+// start starts the span of an MCP request of the given method, on target.
+func (t *Tracer) start(ctx context.Context, method, target string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("mcp.method.name", method))
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		attrs = append(attrs, attribute.String("mcp.session.id", session.SessionID()))
+	}
+	return t.tracer.Start(ctx, method+" "+target, trace.WithAttributes(attrs...))
+}
+
+// RoundTripper implements backend.Observer, creating a span for every request
+// against the backend named datasource and propagating the trace context to
+// it.
+func (t *Tracer) RoundTripper(datasource string, next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next,
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + datasource + " " + r.URL.Path
+		}),
+		otelhttp.WithSpanOptions(trace.WithAttributes(attribute.String("promql_mcp.datasource", datasource))),
+	)
+}
+
+// ObserveCache implements backend.Observer, recording cache lookups as events
+// of the current span.
+func (t *Tracer) ObserveCache(ctx context.Context, datasource, kind string, hit bool) {
+	trace.SpanFromContext(ctx).AddEvent("cache lookup", trace.WithAttributes(
+		attribute.String("promql_mcp.datasource", datasource),
+		attribute.String("promql_mcp.cache.kind", kind),
+		attribute.Bool("promql_mcp.cache.hit", hit),
+	))
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	for _, c := range res.Content {
+		if t, ok := c.(mcp.TextContent); ok {
+			return t.Text
+		}
+	}
+	return ""
+}
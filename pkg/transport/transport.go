@@ -0,0 +1,190 @@
+// Package transport serves the MCP server over stdio, Streamable HTTP and the
+// legacy HTTP+SSE transport, several of which can be served at once.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	Stdio          = "stdio"
+	StreamableHTTP = "streamable-http"
+	SSE            = "sse"
+
+	// DefaultStreamableHTTPPath is the path of the Streamable HTTP endpoint if
+	// none is configured.
+	DefaultStreamableHTTPPath = "/mcp"
+)
+
+// Config configures a transport.
+type Config struct {
+	// Type is stdio, streamable-http or sse.
+	Type string `yaml:"type"`
+	// Address is the address HTTP transports listen on, e.g. :8080. Several
+	// transports can share an address, on different paths.
+	Address string `yaml:"address"`
+	// Path is the path of the Streamable HTTP endpoint, /mcp by default, or
+	// the base path of the /sse and /message endpoints of the SSE transport.
+	Path string `yaml:"path"`
+}
+
+// Parse parses a comma-separated list of transports, e.g. stdio,sse, each of
+// which may be followed by the address it listens on, e.g. sse=:8081. HTTP
+// transports listen on address by default.
+func Parse(s, address string) ([]Config, error) {
+	var cfgs []Config
+	for _, t := range strings.Split(s, ",") {
+		typ, addr, ok := strings.Cut(strings.TrimSpace(t), "=")
+		if !ok {
+			addr = address
+		}
+		cfgs = append(cfgs, Config{Type: typ, Address: addr})
+	}
+	return cfgs, Validate(cfgs)
+}
+
+// Validate checks that the transports are known and don't conflict.
+func Validate(cfgs []Config) error {
+	if len(cfgs) == 0 {
+		return errors.New("no transports configured")
+	}
+	stdio := false
+	endpoints := map[string]string{}
+	for _, c := range cfgs {
+		switch c.Type {
+		case Stdio:
+			if stdio {
+				return errors.New("the stdio transport is configured more than once")
+			}
+			stdio = true
+			continue
+		case StreamableHTTP, SSE:
+		default:
+			return fmt.Errorf("unknown transport %q, expected %s, %s or %s", c.Type, Stdio, StreamableHTTP, SSE)
+		}
+		if c.Address == "" {
+			return fmt.Errorf("the %s transport has no address", c.Type)
+		}
+		for _, p := range c.paths() {
+			key := c.Address + p
+			if other, ok := endpoints[key]; ok {
+				if other == c.Type {
+					return fmt.Errorf("the %s transport is configured more than once on %s%s", c.Type, c.Address, p)
+				}
+				return fmt.Errorf("the %s and %s transports both serve %s on %s", other, c.Type, p, c.Address)
+			}
+			endpoints[key] = c.Type
+		}
+	}
+	return nil
+}
+
+// paths returns the paths an HTTP transport serves.
+func (c Config) paths() []string {
+	switch c.Type {
+	case StreamableHTTP:
+		if c.Path == "" {
+			return []string{DefaultStreamableHTTPPath}
+		}
+		return []string{path.Clean("/" + c.Path)}
+	case SSE:
+		base := path.Clean("/" + c.Path)
+		return []string{path.Join(base, "sse"), path.Join(base, "message")}
+	}
+	return nil
+}
+
+// Listener is an HTTP listener serving one or more transports.
+type Listener struct {
+	Address    string
+	Transports []string
+
+	srv *http.Server
+	// paths are the paths served by the listener.
+	paths []string
+	// closers close the sessions of the transports.
+	closers []func(ctx context.Context)
+}
+
+// Listeners returns the HTTP listeners serving the HTTP transports of cfgs,
+// one per address. wrap, if set, wraps the handlers of every transport, e.g.
+// to authenticate requests, and tlsConfig, if set, terminates TLS.
+func Listeners(mcpServer *server.MCPServer, cfgs []Config, wrap func(http.Handler) http.Handler, tlsConfig *tls.Config) []*Listener {
+	var listeners []*Listener
+	byAddress := map[string]*Listener{}
+	for _, c := range cfgs {
+		if c.Type == Stdio {
+			continue
+		}
+		l, ok := byAddress[c.Address]
+		if !ok {
+			l = &Listener{Address: c.Address, srv: &http.Server{Addr: c.Address, Handler: http.NewServeMux(), TLSConfig: tlsConfig}}
+			byAddress[c.Address] = l
+			listeners = append(listeners, l)
+		}
+
+		var handler http.Handler
+		switch c.Type {
+		case StreamableHTTP:
+			s := server.NewStreamableHTTPServer(mcpServer, server.WithEndpointPath(c.paths()[0]))
+			handler = s
+			l.closers = append(l.closers, func(ctx context.Context) { _ = s.Shutdown(ctx) })
+		case SSE:
+			s := server.NewSSEServer(mcpServer, server.WithStaticBasePath(path.Clean("/"+c.Path)))
+			handler = s
+			l.closers = append(l.closers, func(context.Context) { s.CloseSessions() })
+		}
+		if wrap != nil {
+			handler = wrap(handler)
+		}
+		for _, p := range c.paths() {
+			l.srv.Handler.(*http.ServeMux).Handle(p, handler)
+			l.paths = append(l.paths, p)
+		}
+		l.Transports = append(l.Transports, c.Type+" on "+strings.Join(c.paths(), ", "))
+	}
+	return listeners
+}
+
+// Handle serves handler on the path p of the listener, alongside its
+// transports.
+func (l *Listener) Handle(p string, handler http.Handler) error {
+	if slices.Contains(l.paths, p) {
+		return fmt.Errorf("%s is already served on %s", p, l.Address)
+	}
+	l.srv.Handler.(*http.ServeMux).Handle(p, handler)
+	l.paths = append(l.paths, p)
+	return nil
+}
+
+// Run serves requests until the listener is shut down.
+func (l *Listener) Run() error {
+	var err error
+	if l.srv.TLSConfig != nil {
+		err = l.srv.ListenAndServeTLS("", "")
+	} else {
+		err = l.srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown closes the sessions of the transports, and then waits for
+// in-flight requests to complete until ctx is done.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	for _, c := range l.closers {
+		c(ctx)
+	}
+	return l.srv.Shutdown(ctx)
+}
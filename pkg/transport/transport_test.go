@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		s, address string
+		want       []Config
+		wantErr    string
+	}{
+		{s: "stdio", want: []Config{{Type: Stdio}}},
+		{s: "streamable-http", address: ":8080", want: []Config{{Type: StreamableHTTP, Address: ":8080"}}},
+		{s: "streamable-http, sse=:8081", address: ":8080", want: []Config{{Type: StreamableHTTP, Address: ":8080"}, {Type: SSE, Address: ":8081"}}},
+		{s: "stdio,sse", address: ":8080", want: []Config{{Type: Stdio, Address: ":8080"}, {Type: SSE, Address: ":8080"}}},
+		{s: "streamable-http", wantErr: "the streamable-http transport has no address"},
+		{s: "sse=", address: ":8080", wantErr: "the sse transport has no address"},
+		{s: "stdio,stdio", wantErr: "stdio transport is configured more than once"},
+		{s: "websocket", address: ":8080", wantErr: `unknown transport "websocket"`},
+		{s: "sse,sse", address: ":8080", wantErr: "the sse transport is configured more than once on :8080/sse"},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := Parse(tc.s, tc.address)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			case tc.wantErr == "" && !slices.Equal(got, tc.want):
+				t.Fatalf("got transports %v, expected %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cfgs    []Config
+		wantErr string
+	}{
+		{name: "none", wantErr: "no transports configured"},
+		{name: "every transport", cfgs: []Config{{Type: Stdio}, {Type: StreamableHTTP, Address: ":8080"}, {Type: SSE, Address: ":8080"}}},
+		{name: "same path on other addresses", cfgs: []Config{{Type: StreamableHTTP, Address: ":8080"}, {Type: StreamableHTTP, Address: ":8081"}}},
+		{name: "other paths on the same address", cfgs: []Config{{Type: StreamableHTTP, Address: ":8080"}, {Type: StreamableHTTP, Address: ":8080", Path: "/other"}}},
+		{name: "same path on the same address", cfgs: []Config{{Type: StreamableHTTP, Address: ":8080"}, {Type: StreamableHTTP, Address: ":8080", Path: "mcp/"}}, wantErr: "the streamable-http transport is configured more than once on :8080/mcp"},
+		{name: "sse and streamable-http clash", cfgs: []Config{{Type: SSE, Address: ":8080"}, {Type: StreamableHTTP, Address: ":8080", Path: "/sse"}}, wantErr: "the sse and streamable-http transports both serve /sse on :8080"},
+		{name: "sse under a base path", cfgs: []Config{{Type: SSE, Address: ":8080", Path: "/legacy"}, {Type: StreamableHTTP, Address: ":8080", Path: "/sse"}}},
+		{name: "sse message endpoint clash", cfgs: []Config{{Type: StreamableHTTP, Address: ":8080", Path: "/legacy/message"}, {Type: SSE, Address: ":8080", Path: "/legacy"}}, wantErr: "the streamable-http and sse transports both serve /legacy/message on :8080"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.cfgs)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}